@@ -18,6 +18,7 @@ package config
 import (
 	"flag"
 	"os"
+	"strings"
 )
 
 type Config interface {
@@ -25,6 +26,8 @@ type Config interface {
 	APIPort() string
 	LogLevel() string
 	LogFilePath() string
+	UpstreamRepositories() []string
+	PublishTokens() []string
 }
 
 type Cfg struct {
@@ -32,6 +35,8 @@ type Cfg struct {
 	apiPort          string
 	logLevel         string
 	logFilePath      string
+	upstreamRepos    string
+	publishTokens    string
 }
 
 // Get parses input parameters to program and return a config with them set.
@@ -42,6 +47,9 @@ func Get() Config {
 	flag.StringVar(&conf.apiPort, "apiport", os.Getenv("API_PORT"), "API port.")
 	flag.StringVar(&conf.logLevel, "loglevel", os.Getenv("LOGLEVEL"), "Log level (TRACE, DEBUG, INFO, WARNING, ERROR, FATAL, PANIC).")
 	flag.StringVar(&conf.logFilePath, "logfilepath", os.Getenv("LOG_FILE_PATH"), "Path, including filename, for the log files to create.")
+	flag.StringVar(&conf.upstreamRepos, "upstreamrepositories", os.Getenv("UPSTREAM_REPOSITORIES"), "Comma-separated base URLs of event repositories to query for events that are not found, e.g. http://goer.example.com/v1.")
+
+	flag.StringVar(&conf.publishTokens, "publishtokens", os.Getenv("PUBLISH_TOKENS"), "Comma-separated bearer tokens that are allowed to publish events. Publishing is disabled if not set.")
 
 	flag.Parse()
 	return conf
@@ -69,3 +77,26 @@ func (c *Cfg) LogLevel() string {
 func (c *Cfg) LogFilePath() string {
 	return c.logFilePath
 }
+
+// UpstreamRepositories returns the base URLs of the event repositories to query for
+// events that are not in the database.
+func (c *Cfg) UpstreamRepositories() []string {
+	return split(c.upstreamRepos)
+}
+
+// PublishTokens returns the bearer tokens that are allowed to publish events.
+// Publishing is disabled if there are none.
+func (c *Cfg) PublishTokens() []string {
+	return split(c.publishTokens)
+}
+
+// split splits a comma-separated list, ignoring whitespace around the items and empty items.
+func split(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
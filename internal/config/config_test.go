@@ -31,6 +31,8 @@ func TestGet(t *testing.T) {
 	t.Setenv("API_PORT", port)
 	t.Setenv("LOGLEVEL", logLevel)
 	t.Setenv("LOG_FILE_PATH", logFilePath)
+	t.Setenv("UPSTREAM_REPOSITORIES", "http://goer/v1")
+	t.Setenv("PUBLISH_TOKENS", "secret")
 
 	cfg, ok := Get().(*Cfg)
 	assert.Truef(t, ok, "cfg returned from get is not a config interface")
@@ -38,6 +40,8 @@ func TestGet(t *testing.T) {
 	assert.Equal(t, port, cfg.apiPort)
 	assert.Equal(t, logLevel, cfg.logLevel)
 	assert.Equal(t, logFilePath, cfg.logFilePath)
+	assert.Equal(t, "http://goer/v1", cfg.upstreamRepos)
+	assert.Equal(t, "secret", cfg.publishTokens)
 }
 
 type getter func() string
@@ -69,3 +73,17 @@ func TestGetters(t *testing.T) {
 		})
 	}
 }
+
+// Test that upstream repositories are split on commas.
+func TestUpstreamRepositories(t *testing.T) {
+	cfg := &Cfg{upstreamRepos: "http://goer/v1, http://er:8080,"}
+	assert.Equal(t, []string{"http://goer/v1", "http://er:8080"}, cfg.UpstreamRepositories())
+	assert.Empty(t, (&Cfg{}).UpstreamRepositories())
+}
+
+// Test that publish tokens are split on commas.
+func TestPublishTokens(t *testing.T) {
+	cfg := &Cfg{publishTokens: "one, two"}
+	assert.Equal(t, []string{"one", "two"}, cfg.PublishTokens())
+	assert.Empty(t, (&Cfg{}).PublishTokens())
+}
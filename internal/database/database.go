@@ -23,12 +23,16 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers/archive"
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers/memory"
 	"github.com/eiffel-community/eiffel-goer/internal/database/drivers/mongodb"
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers/postgres"
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers/sqlite"
 )
 
 // Drivers contains the drivers that are supported at the moment.
 // The variable is exported to assist with testing of this and other packages.
-var Drivers = []drivers.DatabaseDriver{&mongodb.Driver{}}
+var Drivers = []drivers.DatabaseDriver{&mongodb.Driver{}, &postgres.Driver{}, &sqlite.Driver{}, &memory.Driver{}, &archive.Driver{}}
 
 // Get a new database driver and connect to database.
 func Get(ctx context.Context, connectionString string, logger *log.Entry) (drivers.Database, error) {
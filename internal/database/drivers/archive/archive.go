@@ -0,0 +1,393 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This package implements a read-only database interface over archives of events,
+// i.e. NDJSON files that may be gzip compressed, for the file:// scheme. Only an
+// index of the events is held in memory and the events are read from the archives
+// when they are requested.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers/memory"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// extensions are the file name extensions of archives.
+var extensions = []string{".ndjson", ".jsonl", ".ndjson.gz", ".jsonl.gz"}
+
+// indexedFields are the fields of the events that are in the index. Conditions and sort
+// orders on these fields only are handled without reading the archives.
+var indexedFields = map[string]struct{}{
+	"meta.id": {}, "meta.type": {}, "meta.time": {}, "links": {}, "links.type": {}, "links.target": {},
+}
+
+// errStop stops reading an archive early.
+var errStop = errors.New("stop")
+
+// Driver is a driver for archives of events.
+type Driver struct{}
+
+// Get indexes the archives in a directory and its subdirectories, or a single archive.
+// The connection string is file://path/to/archives for a relative path or
+// file:///path/to/archives for an absolute path. Archives are files named *.ndjson or
+// *.jsonl, with one event per line, optionally gzip compressed and named e.g. *.ndjson.gz.
+func (d *Driver) Get(ctx context.Context, connectionURL *url.URL, logger *log.Entry) (drivers.Database, error) {
+	path := connectionURL.Opaque
+	if path == "" {
+		path = connectionURL.Host + connectionURL.Path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no archives in %q", connectionURL.Redacted())
+	}
+	database := &Database{
+		index:     memory.New(logger),
+		locations: make(map[string]location),
+		logger:    logger,
+	}
+	if err := database.load(ctx, path); err != nil {
+		return nil, err
+	}
+	logger.Infof("Indexed %d events in %d archives in %s", len(database.locations), len(database.archives), path)
+	return database, nil
+}
+
+// Test whether the archive driver supports a scheme.
+func (d *Driver) SupportsScheme(scheme string) bool {
+	return scheme == "file"
+}
+
+// location is the position of an event in the archives.
+type location struct {
+	archive int
+	line    int
+}
+
+// Database is a read-only database interface for requesting events from archives.
+type Database struct {
+	archives []string
+	// index has events with the indexed fields only.
+	index     *memory.Database
+	locations map[string]location
+	logger    *log.Entry
+}
+
+// load indexes the archives in a directory and its subdirectories, or a single archive.
+// An event that is in more than one archive is read from the first one.
+func (f *Database) load(ctx context.Context, path string) error {
+	err := filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := strings.ToLower(file)
+		if !entry.IsDir() && slices.ContainsFunc(extensions, func(extension string) bool { return strings.HasSuffix(name, extension) }) {
+			f.archives = append(f.archives, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, archive := range f.archives {
+		var stubs []drivers.EiffelEvent
+		err := readArchive(archive, func(line int, event drivers.EiffelEvent) error {
+			if _, ok := f.locations[event.ID()]; ok || event.ID() == "" {
+				return nil
+			}
+			f.locations[event.ID()] = location{archive: i, line: line}
+			stubs = append(stubs, stub(event))
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("indexing %s: %w", archive, err)
+		}
+		if err := f.index.Insert(ctx, stubs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stub returns a copy of an event with the indexed fields only.
+func stub(event drivers.EiffelEvent) drivers.EiffelEvent {
+	meta := map[string]interface{}{}
+	for _, field := range []string{"id", "type", "time"} {
+		if value, ok := event.Get("meta." + field); ok {
+			meta[field] = value
+		}
+	}
+	stub := drivers.EiffelEvent{"meta": meta}
+	if links, ok := event["links"]; ok {
+		stub["links"] = links
+	}
+	return stub
+}
+
+// readArchive calls fn with each event of an archive and its line number.
+// Empty lines are skipped.
+func readArchive(archive string, fn func(line int, event drivers.EiffelEvent) error) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(strings.ToLower(archive), ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		content, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(content)) > 0 {
+			event, decodeErr := drivers.DecodeEvent(content)
+			if decodeErr != nil {
+				return fmt.Errorf("line %d: %w", line, decodeErr)
+			}
+			if fnErr := fn(line, event); fnErr != nil {
+				return fnErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// fetch reads the events of stubs from the archives, in the same order. Each archive
+// is read at most once, and only as far as needed.
+func (f *Database) fetch(stubs []drivers.EiffelEvent) ([]drivers.EiffelEvent, error) {
+	wanted := make(map[int]map[int]string)
+	for _, stub := range stubs {
+		location := f.locations[stub.ID()]
+		if wanted[location.archive] == nil {
+			wanted[location.archive] = make(map[int]string)
+		}
+		wanted[location.archive][location.line] = stub.ID()
+	}
+	found := make(map[string]drivers.EiffelEvent, len(stubs))
+	for archive, lines := range wanted {
+		remaining := len(lines)
+		err := readArchive(f.archives[archive], func(line int, event drivers.EiffelEvent) error {
+			if _, ok := lines[line]; !ok {
+				return nil
+			}
+			found[lines[line]] = event
+			if remaining--; remaining == 0 {
+				return errStop
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStop) {
+			return nil, fmt.Errorf("reading %s: %w", f.archives[archive], err)
+		}
+	}
+	events := make([]drivers.EiffelEvent, 0, len(stubs))
+	for _, stub := range stubs {
+		event, ok := found[stub.ID()]
+		if !ok {
+			return nil, fmt.Errorf("%q was not found again in the archives", stub.ID())
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// scan calls fn with every event in the archives.
+func (f *Database) scan(fn func(event drivers.EiffelEvent) error) error {
+	for i, archive := range f.archives {
+		err := readArchive(archive, func(line int, event drivers.EiffelEvent) error {
+			// Skip the events that are read from an earlier archive.
+			if f.locations[event.ID()] != (location{archive: i, line: line}) {
+				return nil
+			}
+			return fn(event)
+		})
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", archive, err)
+		}
+	}
+	return nil
+}
+
+// indexed tests whether conditions and a sort order only use indexed fields.
+func indexed(conditions []query.Condition, sort requests.Sort) bool {
+	for _, key := range sort {
+		if _, ok := indexedFields[key.Field]; !ok {
+			return false
+		}
+	}
+	for _, condition := range conditions {
+		if condition.IsGroup() {
+			if !indexed(condition.Conditions, nil) {
+				return false
+			}
+			continue
+		}
+		if _, ok := indexedFields[condition.Field]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// GetEvents gets all events information. The events are ordered by meta.id unless
+// another order is requested. Requests on indexed fields only are handled with the
+// index, other requests read all archives.
+func (f *Database) GetEvents(ctx context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+	order := drivers.OrderBy(request.Sort)
+	if !request.Cursor.IsZero() {
+		order = drivers.OrderBy(request.Cursor.Sort)
+	}
+	if indexed(request.Conditions, order) {
+		stubs, numberOfDocuments, err := f.index.GetEvents(ctx, request)
+		if err != nil {
+			return nil, 0, err
+		}
+		events, err := f.fetch(stubs)
+		if err != nil {
+			f.logger.Errorf("Database: %v", err)
+			return nil, 0, err
+		}
+		return events, numberOfDocuments, nil
+	}
+	events, numberOfDocuments, err := f.scanPage(request, order)
+	if err != nil {
+		f.logger.Errorf("Database: %v", err)
+		return nil, 0, err
+	}
+	return events, numberOfDocuments, nil
+}
+
+// scanPage gets a page of events by reading all archives. Only the events up to the
+// end of the page are kept, so memory use depends on the page and not on the archives.
+func (f *Database) scanPage(request requests.MultipleEventsRequest, order requests.Sort) ([]drivers.EiffelEvent, int64, error) {
+	matcher, err := drivers.NewMatcher(request.Conditions)
+	if err != nil {
+		return nil, 0, err
+	}
+	end := request.Skip() + request.PageSize
+	var numberOfDocuments int64
+	var events []drivers.EiffelEvent
+	err = f.scan(func(event drivers.EiffelEvent) error {
+		if !matcher(event) {
+			return nil
+		}
+		numberOfDocuments++
+		if !request.Cursor.IsZero() && !drivers.IsAfter(event, request.Cursor) {
+			return nil
+		}
+		events = append(events, event)
+		if len(events) > 2*end {
+			drivers.SortEvents(events, order)
+			events = events[:end]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return drivers.Page(events, order, request.Skip(), request.PageSize), numberOfDocuments, nil
+}
+
+// UpstreamDownstreamSearch searches for events upstream and/or downstream of event by ID.
+// The links are followed in the index and the conditions are tested on the events that
+// are found.
+func (f *Database) UpstreamDownstreamSearch(ctx context.Context, id string, request requests.SearchRequest) (drivers.SearchResult, error) {
+	matcher, err := drivers.NewMatcher(request.Conditions)
+	if err != nil {
+		f.logger.Errorf("Database: %v", err)
+		return drivers.SearchResult{}, err
+	}
+	indexRequest := request
+	indexRequest.Conditions = nil
+	result, err := f.index.UpstreamDownstreamSearch(ctx, id, indexRequest)
+	if err != nil {
+		return drivers.SearchResult{}, err
+	}
+	events, err := f.fetch(append(slices.Clip(result.Upstream), result.Downstream...))
+	if err != nil {
+		f.logger.Errorf("Database: %v", err)
+		return drivers.SearchResult{}, err
+	}
+	result.Upstream, result.Downstream = events[:len(result.Upstream)], events[len(result.Upstream):]
+	if len(request.Conditions) == 0 {
+		return result, nil
+	}
+	keep := make(map[string]struct{})
+	for _, event := range events {
+		if matcher(event) {
+			keep[event.ID()] = struct{}{}
+		}
+	}
+	return result.Filter(keep), nil
+}
+
+// ShortestPath finds the shortest chain of links from one event to another in the index.
+func (f *Database) ShortestPath(ctx context.Context, request requests.PathRequest) (drivers.Path, error) {
+	path, err := f.index.ShortestPath(ctx, request)
+	if err != nil {
+		return drivers.Path{}, err
+	}
+	if path.Events, err = f.fetch(path.Events); err != nil {
+		f.logger.Errorf("Database: %v", err)
+		return drivers.Path{}, err
+	}
+	return path, nil
+}
+
+// GetEventByID gets an event by ID.
+func (f *Database) GetEventByID(ctx context.Context, id string) (drivers.EiffelEvent, error) {
+	stub, err := f.index.GetEventByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	events, err := f.fetch([]drivers.EiffelEvent{stub})
+	if err != nil {
+		f.logger.Errorf("Database: %v", err)
+		return nil, err
+	}
+	return events[0], nil
+}
+
+// Close the database. The archives are only open while they are read.
+func (f *Database) Close(ctx context.Context) error {
+	return nil
+}
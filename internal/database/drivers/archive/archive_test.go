@@ -0,0 +1,235 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+	"github.com/eiffel-community/eiffel-goer/test/conformance"
+)
+
+// archives are archives with a chain of events, a <- b <- c, where c links to b and b links to a.
+var archives = map[string]string{
+	"2021/08/a.ndjson.gz": `{"meta": {"id": "a", "type": "EiffelActivityTriggeredEvent", "time": 1000}, "links": [], "data": {"name": "x"}}
+`,
+	"2021/08/bc.jsonl.gz": `{"meta": {"id": "b", "type": "EiffelActivityStartedEvent", "time": 2000}, "links": [{"type": "CAUSE", "target": "a"}], "data": {"name": "y"}}
+
+{"meta": {"id": "c", "type": "EiffelActivityFinishedEvent", "time": 3000}, "links": [{"type": "CAUSE", "target": "b"}], "data": {"name": "x"}}`,
+	"2021/09/again.ndjson": `{"meta": {"id": "a", "type": "Duplicate"}, "data": {"name": "x"}}
+`,
+	"README.md": "Not events.",
+}
+
+// write writes files to a directory and compresses those that are named *.gz.
+func write(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		data := []byte(content)
+		if filepath.Ext(name) == ".gz" {
+			var buffer bytes.Buffer
+			gz := gzip.NewWriter(&buffer)
+			_, err := gz.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, gz.Close())
+			data = buffer.Bytes()
+		}
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+}
+
+// open indexes the archives.
+func open(t *testing.T) *Database {
+	t.Helper()
+	dir := t.TempDir()
+	write(t, dir, archives)
+	connectionURL, err := url.Parse("file://" + dir)
+	require.NoError(t, err)
+	db, err := (&Driver{}).Get(context.Background(), connectionURL, log.NewEntry(log.New()))
+	require.NoError(t, err)
+	return db.(*Database)
+}
+
+// ids returns the IDs of events.
+func ids(events []drivers.EiffelEvent) []string {
+	result := []string{}
+	for _, event := range events {
+		result = append(result, event.ID())
+	}
+	return result
+}
+
+// Test that the archives are indexed and that events are read from them.
+func TestGet(t *testing.T) {
+	db := open(t)
+	assert.Len(t, db.archives, 3)
+	assert.Len(t, db.locations, 3)
+	event, err := db.GetEventByID(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, "EiffelActivityTriggeredEvent", event.Type())
+	name, _ := event.Get("data.name")
+	assert.Equal(t, "x", name)
+
+	_, err = db.GetEventByID(context.Background(), "nah")
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+
+	_, err = (&Driver{}).Get(context.Background(), &url.URL{Scheme: "file"}, log.NewEntry(log.New()))
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	write(t, dir, map[string]string{"bad.ndjson.gz": "{}\n{"})
+	_, err = (&Driver{}).Get(context.Background(), &url.URL{Scheme: "file", Path: dir}, log.NewEntry(log.New()))
+	assert.ErrorContains(t, err, "line 2")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.ndjson.gz"), []byte("not gzip"), 0o644))
+	_, err = (&Driver{}).Get(context.Background(), &url.URL{Scheme: "file", Path: dir}, log.NewEntry(log.New()))
+	assert.Error(t, err)
+}
+
+// Test that events are filtered, sorted and paged, with and without the index.
+func TestGetEvents(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		query   string
+		sort    requests.Sort
+		indexed bool
+		want    []string
+		total   int64
+	}{
+		{"indexed", "int(meta.time)%3E=2000|meta.id=a", requests.Sort{{Field: "meta.time", Descending: true}}, true, []string{"c", "b"}, 3},
+		{"condition", "data.name=x", nil, false, []string{"a", "c"}, 2},
+		{"sort", "", requests.Sort{{Field: "data.name", Descending: true}}, false, []string{"b", "a"}, 3},
+		{"group", "(data.name=y|meta.id=a)", nil, false, []string{"a", "b"}, 2},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			var conditions []query.Condition
+			if testCase.query != "" {
+				parsed, err := query.Parse("nofile", []byte(testCase.query))
+				require.NoError(t, err)
+				conditions = parsed.([]query.Condition)
+			}
+			assert.Equal(t, testCase.indexed, indexed(conditions, drivers.OrderBy(testCase.sort)))
+			request := requests.MultipleEventsRequest{PageNo: 1, PageSize: 2, Sort: testCase.sort, Conditions: conditions}
+			events, total, err := db.GetEvents(ctx, request)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.want, ids(events))
+			assert.Equal(t, testCase.total, total)
+
+			cursor, ok := drivers.CursorAfter(events[0], testCase.sort)
+			require.True(t, ok)
+			request.Cursor = cursor
+			events, _, err = db.GetEvents(ctx, request)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.want[1:], ids(events)[:len(testCase.want)-1])
+		})
+	}
+
+	events, total, err := db.GetEvents(ctx, requests.MultipleEventsRequest{PageNo: 2, PageSize: 1, Sort: requests.Sort{{Field: "data.name"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, ids(events))
+	assert.Equal(t, int64(3), total)
+
+	_, _, err = db.GetEvents(ctx, requests.MultipleEventsRequest{
+		Conditions: []query.Condition{{Field: "meta.time", Op: "=", Value: "nah", TypeConv: "int"}},
+	})
+	assert.Error(t, err)
+	_, _, err = db.GetEvents(ctx, requests.MultipleEventsRequest{
+		Conditions: []query.Condition{{Field: "data.name", Op: "=", Value: "nah", TypeConv: "int"}},
+	})
+	assert.Error(t, err)
+}
+
+// Test that links are followed upstream and downstream and that the events are read
+// from the archives.
+func TestUpstreamDownstreamSearch(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	result, err := db.UpstreamDownstreamSearch(ctx, "b", requests.SearchRequest{
+		Limit:            -1,
+		Levels:           -1,
+		SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}, DLT: []string{"CAUSE"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "a"}, ids(result.Upstream))
+	assert.Equal(t, []string{"b", "c"}, ids(result.Downstream))
+	name, _ := result.Downstream[1].Get("data.name")
+	assert.Equal(t, "x", name)
+
+	conditions, err := query.Parse("nofile", []byte("data.name=x"))
+	require.NoError(t, err)
+	result, err = db.UpstreamDownstreamSearch(ctx, "c", requests.SearchRequest{
+		Limit:            -1,
+		Levels:           -1,
+		SearchParameters: requests.SearchParameters{ULT: []string{"CAUSE"}},
+		Conditions:       conditions.([]query.Condition),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "a"}, ids(result.Upstream))
+	assert.Equal(t, []drivers.Edge{{Source: "c", Link: drivers.Link{Type: "CAUSE", Target: "a"}}}, result.UpstreamEdges)
+
+	_, err = db.UpstreamDownstreamSearch(ctx, "nah", requests.SearchRequest{})
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+}
+
+// Test that the events on the shortest path are read from the archives.
+func TestShortestPath(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	path, err := db.ShortestPath(ctx, requests.PathRequest{From: "c", To: "a", LinkTypes: []string{"ALL"}, Levels: -1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b", "a"}, ids(path.Events))
+	name, _ := path.Events[1].Get("data.name")
+	assert.Equal(t, "y", name)
+
+	_, err = db.ShortestPath(ctx, requests.PathRequest{From: "a", To: "c", LinkTypes: []string{"CONTEXT"}, Levels: -1})
+	assert.ErrorIs(t, err, drivers.ErrPathNotFound)
+}
+
+// Test that the archive driver conforms to the driver conformance test suite, with the
+// events split over two archives.
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, events []drivers.EiffelEvent) drivers.Database {
+		files := map[string]string{}
+		for i, event := range events {
+			line, err := json.Marshal(event)
+			require.NoError(t, err)
+			name := fmt.Sprintf("events-%d.ndjson.gz", i%2)
+			files[name] += string(line) + "\n"
+		}
+		dir := t.TempDir()
+		write(t, dir, files)
+		db, err := (&Driver{}).Get(context.Background(), &url.URL{Scheme: "file", Path: dir}, log.NewEntry(log.New()))
+		require.NoError(t, err)
+		return db
+	})
+}
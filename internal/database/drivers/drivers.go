@@ -16,16 +16,70 @@
 package drivers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"maps"
 	"net/url"
+	"reflect"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/eiffel-community/eiffel-goer/internal/requests"
 )
 
+var (
+	// ErrEventNotFound is returned, possibly wrapped, when a requested event does not exist.
+	ErrEventNotFound = errors.New("event not found")
+	// ErrPathNotFound is returned, possibly wrapped, when two events are not linked.
+	ErrPathNotFound = errors.New("no path between events")
+	// ErrReadOnly is returned, possibly wrapped, when events are published to a database
+	// that can not store them.
+	ErrReadOnly = errors.New("database is read-only")
+)
+
 type EiffelEvent map[string]interface{}
 
+// TimeFields are the fields of events that are times in epoch milliseconds. Only meta.time
+// is a time in the Eiffel event schemas.
+var TimeFields = []string{"meta.time"}
+
+// readableTimeLayout is the ISO-8601 layout of times in readable events.
+const readableTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Link is a link from an Eiffel event to another event.
+type Link struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// Edge is a link between two events found by a search. Source is the ID of
+// the event that has the link.
+type Edge struct {
+	Source string `json:"source"`
+	Link
+}
+
+// SearchResult contains the events found by an upstream/downstream search and
+// the links between them. Both event slices start with the event that the
+// search started from.
+type SearchResult struct {
+	Upstream        []EiffelEvent
+	UpstreamEdges   []Edge
+	Downstream      []EiffelEvent
+	DownstreamEdges []Edge
+}
+
+// Path is a chain of links between two events, with the events in the order that
+// they were reached from the first event.
+type Path struct {
+	Events []EiffelEvent `json:"events"`
+	Edges  []Edge        `json:"links"`
+}
+
 type DatabaseDriver interface {
 	Get(context.Context, *url.URL, *log.Entry) (Database, error)
 	SupportsScheme(string) bool
@@ -33,7 +87,343 @@ type DatabaseDriver interface {
 
 type Database interface {
 	GetEvents(context.Context, requests.MultipleEventsRequest) ([]EiffelEvent, int64, error)
-	UpstreamDownstreamSearch(context.Context, string) ([]EiffelEvent, error)
+	UpstreamDownstreamSearch(context.Context, string, requests.SearchRequest) (SearchResult, error)
+	ShortestPath(context.Context, requests.PathRequest) (Path, error)
 	GetEventByID(context.Context, string) (EiffelEvent, error)
 	Close(context.Context) error
 }
+
+// Local returns the database itself, or, for a database that combines a local database
+// with other event repositories, the local database. It is used for shallow requests.
+func Local(db Database) Database {
+	if federated, ok := db.(interface{ Local() Database }); ok {
+		return federated.Local()
+	}
+	return db
+}
+
+// Writer is implemented by databases that events can be published to.
+type Writer interface {
+	// Insert stores events. Events that are already in the database are left as they are,
+	// so publishing the same events again has no effect. An error does not mean that
+	// none of the events were stored, unless the database says so.
+	Insert(ctx context.Context, events ...EiffelEvent) error
+}
+
+// Insert stores events in a database, or in its local database for a database that
+// combines a local database with other event repositories, see Local. Returns
+// ErrReadOnly if the database can not store events.
+func Insert(ctx context.Context, db Database, events ...EiffelEvent) error {
+	writer, ok := Local(db).(Writer)
+	if !ok {
+		return ErrReadOnly
+	}
+	return writer.Insert(ctx, events...)
+}
+
+// DecodeEvent decodes an event from JSON. Integers are decoded as int64 and other numbers
+// as float64, which is how the MongoDB driver decodes them, so that epoch milliseconds
+// keep their precision and events are ordered the same whatever database they come from.
+func DecodeEvent(data []byte) (EiffelEvent, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var event EiffelEvent
+	if err := decoder.Decode(&event); err != nil {
+		return nil, err
+	}
+	for key, value := range event {
+		event[key] = decodeNumbers(value)
+	}
+	return event, nil
+}
+
+// decodeNumbers replaces the json.Numbers in a value decoded with UseNumber.
+func decodeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = decodeNumbers(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = decodeNumbers(child)
+		}
+	}
+	return value
+}
+
+// asEvent converts a decoded JSON object to an EiffelEvent. Database drivers
+// decode nested objects into different map types, e.g. bson.M or EiffelEvent.
+func asEvent(value interface{}) (EiffelEvent, bool) {
+	v := reflect.ValueOf(value)
+	eventType := reflect.TypeOf(EiffelEvent{})
+	if v.Kind() != reflect.Map || !v.Type().ConvertibleTo(eventType) {
+		return nil, false
+	}
+	return v.Convert(eventType).Interface().(EiffelEvent), true
+}
+
+// Get returns the value of a dot separated field, e.g. "meta.id", in the event.
+func (e EiffelEvent) Get(field string) (interface{}, bool) {
+	current := e
+	keys := strings.Split(field, ".")
+	for i, key := range keys {
+		value, ok := current[key]
+		if !ok {
+			return nil, false
+		}
+		if i == len(keys)-1 {
+			return value, true
+		}
+		if current, ok = asEvent(value); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// Project returns a copy of the event with only the given dot separated fields. A field
+// that is an object is included with all of its fields. Fields that the event does not
+// have are left out. The event is returned as is if no fields are given.
+func (e EiffelEvent) Project(fields []string) EiffelEvent {
+	if len(fields) == 0 {
+		return e
+	}
+	projected := EiffelEvent{}
+	for _, field := range requests.Fields(fields).Normalized() {
+		value, ok := e.Get(field)
+		if !ok {
+			continue
+		}
+		current := projected
+		keys := strings.Split(field, ".")
+		for _, key := range keys[:len(keys)-1] {
+			next, ok := current[key].(EiffelEvent)
+			if !ok {
+				next = EiffelEvent{}
+				current[key] = next
+			}
+			current = next
+		}
+		current[keys[len(keys)-1]] = value
+	}
+	return projected
+}
+
+// Readable returns a copy of the event where the TimeFields are ISO-8601 times in UTC,
+// e.g. "2018-10-31T13:36:00.824Z", instead of epoch milliseconds.
+func (e EiffelEvent) Readable() EiffelEvent {
+	readable := e
+	for _, field := range TimeFields {
+		value, ok := e.Get(field)
+		if !ok || typeRank(value) != 1 {
+			continue
+		}
+		millis, ok := toInt(value)
+		if !ok {
+			millis = int64(toFloat(value))
+		}
+		readable = readable.with(field, time.UnixMilli(millis).UTC().Format(readableTimeLayout))
+	}
+	return readable
+}
+
+// with returns a copy of the event with a dot separated field set to a value. Only
+// the objects on the way to the field are copied. The event is returned as is if
+// one of those is not an object.
+func (e EiffelEvent) with(field string, value interface{}) EiffelEvent {
+	key, rest, nested := strings.Cut(field, ".")
+	copied := maps.Clone(e)
+	if !nested {
+		copied[key] = value
+		return copied
+	}
+	child, ok := asEvent(e[key])
+	if !ok {
+		return e
+	}
+	copied[key] = child.with(rest, value)
+	return copied
+}
+
+// getString returns the value of a field if it is a string.
+func (e EiffelEvent) getString(field string) string {
+	value, _ := e.Get(field)
+	s, _ := value.(string)
+	return s
+}
+
+// ID returns the meta.id of the event.
+func (e EiffelEvent) ID() string {
+	return e.getString("meta.id")
+}
+
+// Type returns the meta.type of the event.
+func (e EiffelEvent) Type() string {
+	return e.getString("meta.type")
+}
+
+// Links returns all links of the event.
+func (e EiffelEvent) Links() []Link {
+	value, _ := e.Get("links")
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return nil
+	}
+	links := make([]Link, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		link, ok := asEvent(v.Index(i).Interface())
+		if !ok {
+			continue
+		}
+		links = append(links, Link{Type: link.getString("type"), Target: link.getString("target")})
+	}
+	return links
+}
+
+// MatchesLinkType tests whether a link type is one of the link types in a list,
+// taking requests.LinkTypeAll into account.
+func MatchesLinkType(linkType string, linkTypes []string) bool {
+	for _, t := range linkTypes {
+		if t == linkType || t == requests.LinkTypeAll {
+			return true
+		}
+	}
+	return false
+}
+
+// EdgesBetween returns all links, of any of the given link types, between the events.
+func EdgesBetween(events []EiffelEvent, linkTypes []string) []Edge {
+	ids := make(map[string]struct{}, len(events))
+	for _, event := range events {
+		ids[event.ID()] = struct{}{}
+	}
+	var edges []Edge
+	for _, event := range events {
+		for _, link := range event.Links() {
+			if _, ok := ids[link.Target]; ok && MatchesLinkType(link.Type, linkTypes) {
+				edges = append(edges, Edge{Source: event.ID(), Link: link})
+			}
+		}
+	}
+	return edges
+}
+
+// FilterEvents removes the events that are not in keep from the events and edges found
+// by a search in one direction. The first event, which the search started from, is always
+// kept. Paths through removed events are replaced by edges between the kept events at
+// each end, with the type of the last link on the path. The edges are followed from
+// source to target if upstream is true and from target to source otherwise.
+func FilterEvents(events []EiffelEvent, edges []Edge, keep map[string]struct{}, upstream bool) ([]EiffelEvent, []Edge) {
+	if len(events) == 0 {
+		return events, edges
+	}
+	kept := map[string]struct{}{events[0].ID(): {}}
+	filtered := []EiffelEvent{events[0]}
+	for _, event := range events[1:] {
+		if _, ok := keep[event.ID()]; ok {
+			kept[event.ID()] = struct{}{}
+			filtered = append(filtered, event)
+		}
+	}
+
+	next := make(map[string][]Edge)
+	for _, edge := range edges {
+		from := edge.Target
+		if upstream {
+			from = edge.Source
+		}
+		next[from] = append(next[from], edge)
+	}
+	var filteredEdges []Edge
+	for _, event := range filtered {
+		visited := map[string]struct{}{}
+		queue := []string{event.ID()}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, edge := range next[current] {
+				to := edge.Source
+				if upstream {
+					to = edge.Target
+				}
+				if _, ok := visited[to]; ok {
+					continue
+				}
+				visited[to] = struct{}{}
+				if _, ok := kept[to]; !ok {
+					queue = append(queue, to)
+					continue
+				}
+				if upstream {
+					filteredEdges = append(filteredEdges, Edge{Source: event.ID(), Link: Link{Type: edge.Type, Target: to}})
+				} else {
+					filteredEdges = append(filteredEdges, Edge{Source: to, Link: Link{Type: edge.Type, Target: event.ID()}})
+				}
+			}
+		}
+	}
+	return filtered, filteredEdges
+}
+
+// PathTo returns the shortest path from the first event to the event with ID to, along
+// the edges found by a search in one direction. The edges are followed from source to
+// target if upstream is true and from target to source otherwise. Returns false if there
+// is no such path.
+func PathTo(events []EiffelEvent, edges []Edge, to string, upstream bool) (Path, bool) {
+	if len(events) == 0 {
+		return Path{}, false
+	}
+	byID := make(map[string]EiffelEvent, len(events))
+	for _, event := range events {
+		byID[event.ID()] = event
+	}
+	next := make(map[string][]Edge)
+	for _, edge := range edges {
+		from := edge.Target
+		if upstream {
+			from = edge.Source
+		}
+		next[from] = append(next[from], edge)
+	}
+
+	start := events[0].ID()
+	previous := map[string]Edge{}
+	queue := []string{start}
+	for len(queue) > 0 && queue[0] != to {
+		current := queue[0]
+		queue = queue[1:]
+		for _, edge := range next[current] {
+			child := edge.Source
+			if upstream {
+				child = edge.Target
+			}
+			if _, ok := previous[child]; ok || child == start {
+				continue
+			}
+			previous[child] = edge
+			queue = append(queue, child)
+		}
+	}
+	if len(queue) == 0 {
+		return Path{}, false
+	}
+
+	path := Path{Events: []EiffelEvent{byID[to]}}
+	for current := to; current != start; {
+		edge := previous[current]
+		current = edge.Target
+		if upstream {
+			current = edge.Source
+		}
+		path.Events = append([]EiffelEvent{byID[current]}, path.Events...)
+		path.Edges = append([]Edge{edge}, path.Edges...)
+	}
+	return path, true
+}
@@ -0,0 +1,247 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var artifactJSON = []byte(`
+{
+    "data": {
+        "identity": "pkg:maven/my.namespace/my-name@1.0.0"
+    },
+    "links": [
+        {"type": "CAUSE", "target": "e04cf9d3-4d57-471e-bd65-f8fc20d21d84"},
+        {"type": "CONTEXT", "target": "1d1a8c4a-3ab0-4b0e-9a6f-6b1d6c8a1f2e"}
+    ],
+    "meta": {
+        "id": "3fabaa6b-5343-4d74-8af9-dc2e4c1f2827",
+        "time": 1629449650361,
+        "type": "EiffelArtifactCreatedEvent",
+        "version": "3.0.0"
+    }
+}
+`)
+
+// Test that fields and links can be read from an event.
+func TestEventAccessors(t *testing.T) {
+	event := make(EiffelEvent)
+	require.NoError(t, json.Unmarshal(artifactJSON, &event))
+
+	assert.Equal(t, "3fabaa6b-5343-4d74-8af9-dc2e4c1f2827", event.ID())
+	assert.Equal(t, "EiffelArtifactCreatedEvent", event.Type())
+	assert.Equal(t, []Link{
+		{Type: "CAUSE", Target: "e04cf9d3-4d57-471e-bd65-f8fc20d21d84"},
+		{Type: "CONTEXT", Target: "1d1a8c4a-3ab0-4b0e-9a6f-6b1d6c8a1f2e"},
+	}, event.Links())
+
+	identity, ok := event.Get("data.identity")
+	assert.True(t, ok)
+	assert.Equal(t, "pkg:maven/my.namespace/my-name@1.0.0", identity)
+	_, ok = event.Get("data.identity.nah")
+	assert.False(t, ok)
+	_, ok = event.Get("data.nah")
+	assert.False(t, ok)
+}
+
+// Test that integers are decoded as int64 and other numbers as float64.
+func TestDecodeEvent(t *testing.T) {
+	event, err := DecodeEvent([]byte(`{"meta": {"time": 1629449650361}, "data": {"values": [1.5, 2, "3"]}}`))
+	require.NoError(t, err)
+	time, _ := event.Get("meta.time")
+	assert.Equal(t, int64(1629449650361), time)
+	values, _ := event.Get("data.values")
+	assert.Equal(t, []interface{}{1.5, int64(2), "3"}, values)
+
+	_, err = DecodeEvent([]byte(`[]`))
+	assert.Error(t, err)
+}
+
+// Test that nested objects decoded into named map types are handled.
+func TestEventAccessorsNamedMaps(t *testing.T) {
+	type namedMap map[string]interface{}
+	event := EiffelEvent{
+		"meta":  EiffelEvent{"id": "id"},
+		"links": []interface{}{namedMap{"type": "CAUSE", "target": "target"}},
+	}
+	assert.Equal(t, "id", event.ID())
+	assert.Equal(t, []Link{{Type: "CAUSE", Target: "target"}}, event.Links())
+}
+
+// Test that events are projected to the requested fields.
+func TestProject(t *testing.T) {
+	event := make(EiffelEvent)
+	require.NoError(t, json.Unmarshal(artifactJSON, &event))
+
+	projected := event.Project([]string{"meta.type", "data", "meta.id", "data.identity", "meta.nah"})
+	assert.Equal(t, EiffelEvent{
+		"meta": EiffelEvent{"id": "3fabaa6b-5343-4d74-8af9-dc2e4c1f2827", "type": "EiffelArtifactCreatedEvent"},
+		"data": map[string]interface{}{"identity": "pkg:maven/my.namespace/my-name@1.0.0"},
+	}, projected)
+	assert.Len(t, event, 3, "the event must not be modified")
+	assert.Equal(t, event, event.Project(nil))
+}
+
+// Test that event times are made readable without modifying the event.
+func TestReadable(t *testing.T) {
+	event := make(EiffelEvent)
+	require.NoError(t, json.Unmarshal(artifactJSON, &event))
+
+	readable := event.Readable()
+	time, _ := readable.Get("meta.time")
+	assert.Equal(t, "2021-08-20T08:54:10.361Z", time)
+	id, _ := readable.Get("meta.id")
+	assert.Equal(t, event.ID(), id)
+	assert.Equal(t, event["data"], readable["data"])
+	time, _ = event.Get("meta.time")
+	assert.Equal(t, 1629449650361.0, time)
+
+	named := EiffelEvent{"meta": map[string]interface{}{"time": int64(0)}}
+	time, _ = named.Readable().Get("meta.time")
+	assert.Equal(t, "1970-01-01T00:00:00.000Z", time)
+
+	noTime := EiffelEvent{"meta": EiffelEvent{"time": "2021-08-20T08:54:10.361Z"}}
+	assert.Equal(t, noTime, noTime.Readable())
+	assert.Equal(t, EiffelEvent{"meta": "nah"}, EiffelEvent{"meta": "nah"}.Readable())
+}
+
+// Test that link types are matched, including the ALL link type.
+func TestMatchesLinkType(t *testing.T) {
+	assert.True(t, MatchesLinkType("CAUSE", []string{"CONTEXT", "CAUSE"}))
+	assert.True(t, MatchesLinkType("CAUSE", []string{"ALL"}))
+	assert.False(t, MatchesLinkType("CAUSE", []string{"CONTEXT"}))
+	assert.False(t, MatchesLinkType("CAUSE", nil))
+}
+
+// Test that only links of the given types between the given events are returned.
+func TestEdgesBetween(t *testing.T) {
+	artifact := make(EiffelEvent)
+	require.NoError(t, json.Unmarshal(artifactJSON, &artifact))
+	activity := EiffelEvent{"meta": map[string]interface{}{"id": "e04cf9d3-4d57-471e-bd65-f8fc20d21d84"}}
+	events := []EiffelEvent{artifact, activity}
+
+	expected := []Edge{{
+		Source: "3fabaa6b-5343-4d74-8af9-dc2e4c1f2827",
+		Link:   Link{Type: "CAUSE", Target: "e04cf9d3-4d57-471e-bd65-f8fc20d21d84"},
+	}}
+	assert.Equal(t, expected, EdgesBetween(events, []string{"ALL"}))
+	assert.Equal(t, expected, EdgesBetween(events, []string{"CAUSE", "CONTEXT"}))
+	assert.Empty(t, EdgesBetween(events, []string{"CONTEXT"}))
+}
+
+// Test that filtered out events are removed and that paths through them are kept.
+func TestFilterEvents(t *testing.T) {
+	// a -CAUSE-> b -CONTEXT-> c -FLOW_CONTEXT-> d, and a -CAUSE-> d.
+	a := EiffelEvent{"meta": map[string]interface{}{"id": "a"}}
+	b := EiffelEvent{"meta": map[string]interface{}{"id": "b"}}
+	c := EiffelEvent{"meta": map[string]interface{}{"id": "c"}}
+	d := EiffelEvent{"meta": map[string]interface{}{"id": "d"}}
+	edges := []Edge{
+		{Source: "a", Link: Link{Type: "CAUSE", Target: "b"}},
+		{Source: "b", Link: Link{Type: "CONTEXT", Target: "c"}},
+		{Source: "c", Link: Link{Type: "FLOW_CONTEXT", Target: "d"}},
+		{Source: "a", Link: Link{Type: "CAUSE", Target: "d"}},
+	}
+	keep := map[string]struct{}{"c": {}, "d": {}}
+
+	// Upstream from a.
+	events, filteredEdges := FilterEvents([]EiffelEvent{a, b, c, d}, edges, keep, true)
+	assert.Equal(t, []EiffelEvent{a, c, d}, events)
+	assert.ElementsMatch(t, []Edge{
+		{Source: "a", Link: Link{Type: "CONTEXT", Target: "c"}},
+		{Source: "a", Link: Link{Type: "CAUSE", Target: "d"}},
+		{Source: "c", Link: Link{Type: "FLOW_CONTEXT", Target: "d"}},
+	}, filteredEdges)
+
+	// Downstream from d.
+	keep = map[string]struct{}{"a": {}}
+	events, filteredEdges = FilterEvents([]EiffelEvent{d, c, b, a}, edges, keep, false)
+	assert.Equal(t, []EiffelEvent{d, a}, events)
+	assert.Equal(t, []Edge{{Source: "a", Link: Link{Type: "CAUSE", Target: "d"}}}, filteredEdges)
+}
+
+// Test that the shortest path is found in both directions.
+func TestPathTo(t *testing.T) {
+	// a -CAUSE-> b -CONTEXT-> c -FLOW_CONTEXT-> d, and a -CAUSE-> c.
+	a := EiffelEvent{"meta": map[string]interface{}{"id": "a"}}
+	b := EiffelEvent{"meta": map[string]interface{}{"id": "b"}}
+	c := EiffelEvent{"meta": map[string]interface{}{"id": "c"}}
+	d := EiffelEvent{"meta": map[string]interface{}{"id": "d"}}
+	edges := []Edge{
+		{Source: "a", Link: Link{Type: "CAUSE", Target: "b"}},
+		{Source: "b", Link: Link{Type: "CONTEXT", Target: "c"}},
+		{Source: "c", Link: Link{Type: "FLOW_CONTEXT", Target: "d"}},
+		{Source: "a", Link: Link{Type: "CAUSE", Target: "c"}},
+	}
+
+	path, ok := PathTo([]EiffelEvent{a, b, c, d}, edges, "d", true)
+	assert.True(t, ok)
+	assert.Equal(t, Path{
+		Events: []EiffelEvent{a, c, d},
+		Edges:  []Edge{edges[3], edges[2]},
+	}, path)
+
+	path, ok = PathTo([]EiffelEvent{d, c, b, a}, edges, "a", false)
+	assert.True(t, ok)
+	assert.Equal(t, Path{
+		Events: []EiffelEvent{d, c, a},
+		Edges:  []Edge{edges[2], edges[3]},
+	}, path)
+
+	path, ok = PathTo([]EiffelEvent{a}, nil, "a", true)
+	assert.True(t, ok)
+	assert.Equal(t, Path{Events: []EiffelEvent{a}}, path)
+
+	_, ok = PathTo([]EiffelEvent{d, c, b, a}, edges, "a", true)
+	assert.False(t, ok)
+}
+
+// writer is a database that events can be published to, in a federated database.
+type writer struct {
+	Database
+	inserted []EiffelEvent
+}
+
+func (w *writer) Insert(_ context.Context, events ...EiffelEvent) error {
+	w.inserted = append(w.inserted, events...)
+	return nil
+}
+
+type federated struct {
+	Database
+	local Database
+}
+
+func (f federated) Local() Database {
+	return f.local
+}
+
+// Test that events are inserted in the local database, unless it is read-only.
+func TestInsert(t *testing.T) {
+	event, err := DecodeEvent(artifactJSON)
+	require.NoError(t, err)
+	local := &writer{}
+	require.NoError(t, Insert(context.Background(), federated{local: local}, event))
+	assert.Equal(t, []EiffelEvent{event}, local.inserted)
+
+	assert.ErrorIs(t, Insert(context.Background(), federated{local: federated{}}, event), ErrReadOnly)
+}
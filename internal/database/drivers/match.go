@@ -0,0 +1,188 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package drivers
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+)
+
+// Matcher tests whether an event matches conditions.
+type Matcher func(event EiffelEvent) bool
+
+// NewMatcher creates a Matcher for conditions that all must match, for drivers that
+// filter events themselves. The conditions match in the same way as in MongoDB: a
+// condition on an array matches if it matches any element, fields of objects in arrays
+// are found through the arrays, values of different types never match and negated
+// conditions, != and notin, match events that do not have the field.
+func NewMatcher(conditions []query.Condition) (Matcher, error) {
+	matchers := make([]Matcher, 0, len(conditions))
+	for _, condition := range conditions {
+		matcher, err := newConditionMatcher(condition)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	return func(event EiffelEvent) bool {
+		for _, matcher := range matchers {
+			if !matcher(event) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// newConditionMatcher creates a Matcher for a condition, which may be a group.
+func newConditionMatcher(condition query.Condition) (Matcher, error) {
+	switch condition.Op {
+	case query.OpAnd:
+		return NewMatcher(condition.Conditions)
+	case query.OpOr:
+		branches := make([]Matcher, 0, len(condition.Conditions))
+		for _, branch := range condition.Conditions {
+			matcher, err := newConditionMatcher(branch)
+			if err != nil {
+				return nil, err
+			}
+			branches = append(branches, matcher)
+		}
+		return func(event EiffelEvent) bool {
+			for _, branch := range branches {
+				if branch(event) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "exists":
+		exists, err := query.CastValue(condition.TypeConv, condition.Value)
+		if err != nil {
+			return nil, err
+		}
+		return func(event EiffelEvent) bool {
+			_, found := fieldValues(event, condition.Field)
+			return found == exists
+		}, nil
+	}
+
+	var matches func(value interface{}) bool
+	if condition.IsStringMatch() {
+		pattern, err := condition.Pattern()
+		if err != nil {
+			return nil, err
+		}
+		re := regexp.MustCompile(pattern)
+		matches = func(value interface{}) bool {
+			s, ok := value.(string)
+			return ok && re.MatchString(s)
+		}
+	} else {
+		compare, ok := comparisons[condition.Op]
+		if !ok {
+			return nil, fmt.Errorf("unsupported operator %q", condition.Op)
+		}
+		values := []string{condition.Value}
+		if condition.Op == query.OpIn || condition.Op == query.OpNotIn {
+			values = condition.Values
+		}
+		targets := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			target, err := query.CastValue(condition.TypeConv, value)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target)
+		}
+		matches = func(value interface{}) bool {
+			for _, target := range targets {
+				if typeRank(value) == typeRank(target) && compare(CompareValues(value, target)) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	negated := condition.Op == "!=" || condition.Op == query.OpNotIn
+	return func(event EiffelEvent) bool {
+		values, _ := fieldValues(event, condition.Field)
+		for _, value := range values {
+			if matches(value) {
+				return !negated
+			}
+		}
+		return negated
+	}, nil
+}
+
+// comparisons tests the result of CompareValues for each operator. The negated
+// operators test for equality, which is negated for the whole field.
+var comparisons = map[string]func(int) bool{
+	"=":           func(c int) bool { return c == 0 },
+	"!=":          func(c int) bool { return c == 0 },
+	">":           func(c int) bool { return c > 0 },
+	"<":           func(c int) bool { return c < 0 },
+	">=":          func(c int) bool { return c >= 0 },
+	"<=":          func(c int) bool { return c <= 0 },
+	query.OpIn:    func(c int) bool { return c == 0 },
+	query.OpNotIn: func(c int) bool { return c == 0 },
+}
+
+// fieldValues returns the values of a dot separated field that conditions are tested on.
+// Arrays on the way to the field are searched for the rest of the field and an array
+// value is replaced by its elements. Returns false if the event does not have the field.
+func fieldValues(event EiffelEvent, field string) ([]interface{}, bool) {
+	current := []interface{}{event}
+	for _, key := range strings.Split(field, ".") {
+		var next []interface{}
+		for _, value := range current {
+			for _, element := range elements(value) {
+				if object, ok := asEvent(element); ok {
+					if child, ok := object[key]; ok {
+						next = append(next, child)
+					}
+				}
+			}
+		}
+		if len(next) == 0 {
+			return nil, false
+		}
+		current = next
+	}
+	var values []interface{}
+	for _, value := range current {
+		values = append(values, elements(value)...)
+	}
+	return values, true
+}
+
+// elements returns the elements of an array or the value itself if it is not an array.
+func elements(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return []interface{}{value}
+	}
+	result := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		result = append(result, v.Index(i).Interface())
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package drivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+)
+
+// Test that events are matched with MongoDB semantics.
+func TestMatcher(t *testing.T) {
+	event, err := DecodeEvent(artifactJSON)
+	require.NoError(t, err)
+	event["data"].(map[string]interface{})["tags"] = []interface{}{"x", "y"}
+	event["data"].(map[string]interface{})["ok"] = true
+
+	tests := []struct {
+		query   string
+		matches bool
+	}{
+		{"meta.type=EiffelArtifactCreatedEvent", true},
+		{"meta.type!=EiffelArtifactCreatedEvent", false},
+		{"meta.type!=nah", true},
+		{"data.nah!=nah", true},
+		{"int(meta.time)=1629449650361", true},
+		{"meta.time=1629449650361", false},
+		{"int(meta.time)%3E1629449650361", false},
+		{"int(meta.time)%3E=1629449650361", true},
+		{"double(meta.time)%3C1629449650361.5", true},
+		{"time(meta.time)%3E2021-08-20", true},
+		{"bool(data.ok)=true", true},
+		{"data.ok=true", false},
+		{"data.tags=y", true},
+		{"data.tags!=y", false},
+		{"links.type=CONTEXT", true},
+		{"links.type!=in(CAUSE,CONTEXT)", false},
+		{"links.type=in(nah,CAUSE)", true},
+		{"data.identity^=pkg:maven/my.namespace", true},
+		{"data.identity^=pkg:maven/my-namespace", false},
+		{"data.identity**=MY-NAME", true},
+		{"data.identity*=MY-NAME", false},
+		{"data.identity~=@[0-9.]%2B$", true},
+		{"data", true},
+		{"links.target", true},
+		{"!data.nah", true},
+		{"!meta", false},
+		{"meta.id=nah|meta.type=EiffelArtifactCreatedEvent", true},
+		{"(meta.id=nah|meta.type=nah)&meta.version=3.0.0", false},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.query, func(t *testing.T) {
+			conditions, err := query.Parse("nofile", []byte(testCase.query))
+			require.NoError(t, err)
+			matcher, err := NewMatcher(conditions.([]query.Condition))
+			require.NoError(t, err)
+			assert.Equal(t, testCase.matches, matcher(event))
+		})
+	}
+
+	matcher, err := NewMatcher(nil)
+	require.NoError(t, err)
+	assert.True(t, matcher(event))
+
+	_, err = NewMatcher([]query.Condition{{Field: "meta.time", Op: "=", Value: "nah", TypeConv: "int"}})
+	assert.Error(t, err)
+}
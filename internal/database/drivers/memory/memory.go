@@ -0,0 +1,322 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This package implements the database interface with the events held in memory,
+// optionally loaded from JSON or NDJSON files, for demos, tests and for looking
+// into exported event dumps.
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// maxLineSize is the size of the longest NDJSON line, i.e. event, that can be loaded.
+const maxLineSize = 16 * 1024 * 1024
+
+// Driver is an in-memory database driver.
+type Driver struct{}
+
+// Get creates a database in memory. The connection string is memory:// for an empty
+// database, or memory://path/to/dir for a relative path or memory:///path/to/dir for an
+// absolute path to a directory, or a single file, of events to load. Files named *.json
+// have one event or an array of events and files named *.ndjson or *.jsonl have one
+// event per line.
+func (d *Driver) Get(ctx context.Context, connectionURL *url.URL, logger *log.Entry) (drivers.Database, error) {
+	database := New(logger)
+	path := connectionURL.Opaque
+	if path == "" {
+		path = connectionURL.Host + connectionURL.Path
+	}
+	if path == "" {
+		return database, nil
+	}
+	if err := database.Load(ctx, path); err != nil {
+		return nil, err
+	}
+	logger.Infof("Loaded %d events from %s", database.Len(), path)
+	return database, nil
+}
+
+// Test whether the in-memory driver supports a scheme.
+func (d *Driver) SupportsScheme(scheme string) bool {
+	return scheme == "memory"
+}
+
+// Database is a database interface for requesting events held in memory.
+type Database struct {
+	events []drivers.EiffelEvent
+	byID   map[string]drivers.EiffelEvent
+	// linkedFrom maps the ID of every link target to the events with links to it.
+	linkedFrom map[string][]drivers.EiffelEvent
+	mutex      sync.RWMutex
+	logger     *log.Entry
+}
+
+// New creates an empty database.
+func New(logger *log.Entry) *Database {
+	return &Database{
+		byID:       make(map[string]drivers.EiffelEvent),
+		linkedFrom: make(map[string][]drivers.EiffelEvent),
+		logger:     logger,
+	}
+}
+
+// Len returns the number of events in the database.
+func (m *Database) Len() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.events)
+}
+
+// Insert stores events in the database. Events that are already in the database
+// are left as they are.
+func (m *Database) Insert(_ context.Context, events ...drivers.EiffelEvent) error {
+	for _, event := range events {
+		if event.ID() == "" {
+			return errors.New("event has no meta.id")
+		}
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, event := range events {
+		if _, ok := m.byID[event.ID()]; ok {
+			continue
+		}
+		m.events = append(m.events, event)
+		m.byID[event.ID()] = event
+		for _, link := range event.Links() {
+			m.linkedFrom[link.Target] = append(m.linkedFrom[link.Target], event)
+		}
+	}
+	return nil
+}
+
+// Load inserts the events of the JSON and NDJSON files in a directory and its
+// subdirectories, or of a single file.
+func (m *Database) Load(ctx context.Context, path string) error {
+	return filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		var events []drivers.EiffelEvent
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".json":
+			events, err = readJSON(file)
+		case ".ndjson", ".jsonl":
+			events, err = readNDJSONFile(file)
+		default:
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", file, err)
+		}
+		return m.Insert(ctx, events...)
+	})
+}
+
+// readJSON reads a file with an event or an array of events.
+func readJSON(file string) ([]drivers.EiffelEvent, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	content = bytes.TrimSpace(content)
+	if !bytes.HasPrefix(content, []byte("[")) {
+		event, err := drivers.DecodeEvent(content)
+		return []drivers.EiffelEvent{event}, err
+	}
+	var documents []json.RawMessage
+	if err := json.Unmarshal(content, &documents); err != nil {
+		return nil, err
+	}
+	events := make([]drivers.EiffelEvent, 0, len(documents))
+	for _, document := range documents {
+		event, err := drivers.DecodeEvent(document)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// readNDJSONFile reads a file with one event per line.
+func readNDJSONFile(file string) ([]drivers.EiffelEvent, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readNDJSON(f)
+}
+
+// readNDJSON reads events, one per line. Empty lines are skipped.
+func readNDJSON(r io.Reader) ([]drivers.EiffelEvent, error) {
+	var events []drivers.EiffelEvent
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		event, err := drivers.DecodeEvent(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// GetEvents gets all events information. The events are ordered by meta.id unless
+// another order is requested. All events are held together, so lazy pages are the
+// same as other pages.
+func (m *Database) GetEvents(ctx context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+	matcher, err := drivers.NewMatcher(request.Conditions)
+	if err != nil {
+		m.logger.Errorf("Database: %v", err)
+		return nil, 0, err
+	}
+	order := drivers.OrderBy(request.Sort)
+	if !request.Cursor.IsZero() {
+		order = drivers.OrderBy(request.Cursor.Sort)
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var numberOfDocuments int64
+	var events []drivers.EiffelEvent
+	for _, event := range m.events {
+		if !matcher(event) {
+			continue
+		}
+		numberOfDocuments++
+		if request.Cursor.IsZero() || drivers.IsAfter(event, request.Cursor) {
+			events = append(events, event)
+		}
+	}
+	return drivers.Page(events, order, request.Skip(), request.PageSize), numberOfDocuments, nil
+}
+
+// graph finds events and follows links in the database for searches. The caller
+// holds the read lock.
+func (m *Database) graph() drivers.Graph {
+	return drivers.Graph{
+		GetEventByID: m.getEventByID,
+		Upstream:     m.upstreamEvents,
+		Downstream:   m.downstreamEvents,
+		Matching:     matching,
+		Logger:       m.logger,
+	}
+}
+
+// UpstreamDownstreamSearch searches for events upstream and/or downstream of event by ID.
+func (m *Database) UpstreamDownstreamSearch(ctx context.Context, id string, request requests.SearchRequest) (drivers.SearchResult, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.graph().UpstreamDownstreamSearch(ctx, id, request)
+}
+
+// ShortestPath finds the shortest chain of links from one event to another, following
+// the links either from the first event towards the second one or the other way around.
+func (m *Database) ShortestPath(ctx context.Context, request requests.PathRequest) (drivers.Path, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.graph().ShortestPath(ctx, request)
+}
+
+// matching returns the IDs of the events that match all conditions.
+func matching(_ context.Context, conditions []query.Condition, events []drivers.EiffelEvent) (map[string]struct{}, error) {
+	matcher, err := drivers.NewMatcher(conditions)
+	if err != nil {
+		return nil, err
+	}
+	matches := make(map[string]struct{})
+	for _, event := range events {
+		if matcher(event) {
+			matches[event.ID()] = struct{}{}
+		}
+	}
+	return matches, nil
+}
+
+// upstreamEvents finds the events that the events in frontier link to.
+func (m *Database) upstreamEvents(_ context.Context, frontier []drivers.EiffelEvent, linkTypes []string) ([]drivers.EiffelEvent, error) {
+	var events []drivers.EiffelEvent
+	for _, id := range drivers.LinkTargets(frontier, linkTypes) {
+		if target, ok := m.byID[id]; ok {
+			events = append(events, target)
+		}
+	}
+	return events, nil
+}
+
+// downstreamEvents finds the events that link to the events in frontier.
+func (m *Database) downstreamEvents(_ context.Context, frontier []drivers.EiffelEvent, linkTypes []string) ([]drivers.EiffelEvent, error) {
+	var events []drivers.EiffelEvent
+	for _, event := range frontier {
+		for _, source := range m.linkedFrom[event.ID()] {
+			for _, link := range source.Links() {
+				if link.Target == event.ID() && drivers.MatchesLinkType(link.Type, linkTypes) {
+					events = append(events, source)
+					break
+				}
+			}
+		}
+	}
+	return events, nil
+}
+
+// GetEventByID gets an event by ID.
+func (m *Database) GetEventByID(ctx context.Context, id string) (drivers.EiffelEvent, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.getEventByID(ctx, id)
+}
+
+// getEventByID gets an event by ID. The caller holds the read lock.
+func (m *Database) getEventByID(_ context.Context, id string) (drivers.EiffelEvent, error) {
+	event, ok := m.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", id, drivers.ErrEventNotFound)
+	}
+	return event, nil
+}
+
+// Close the database. The events are kept in memory until the database is no longer used.
+func (m *Database) Close(ctx context.Context) error {
+	return nil
+}
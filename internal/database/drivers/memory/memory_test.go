@@ -0,0 +1,183 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package memory
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+	"github.com/eiffel-community/eiffel-goer/test/conformance"
+)
+
+// fixtures are files with a chain of events, a <- b <- c, where c links to b and b links to a.
+var fixtures = map[string]string{
+	"a.json": `{"meta": {"id": "a", "type": "EiffelActivityTriggeredEvent", "time": 1000}, "links": []}`,
+	"dump/bc.ndjson": `{"meta": {"id": "b", "type": "EiffelActivityStartedEvent", "time": 2000}, "links": [{"type": "CAUSE", "target": "a"}]}
+
+{"meta": {"id": "c", "type": "EiffelActivityFinishedEvent", "time": 3000}, "links": [{"type": "CAUSE", "target": "b"}]}
+`,
+	"dump/again.json": `[{"meta": {"id": "a", "type": "Duplicate"}}]`,
+	"README.md":       "Not events.",
+}
+
+// open loads the fixtures into a database.
+func open(t *testing.T) *Database {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range fixtures {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	connectionURL, err := url.Parse("memory://" + dir)
+	require.NoError(t, err)
+	db, err := (&Driver{}).Get(context.Background(), connectionURL, log.NewEntry(log.New()))
+	require.NoError(t, err)
+	return db.(*Database)
+}
+
+// ids returns the IDs of events.
+func ids(events []drivers.EiffelEvent) []string {
+	result := []string{}
+	for _, event := range events {
+		result = append(result, event.ID())
+	}
+	return result
+}
+
+// Test that events are loaded from JSON and NDJSON files.
+func TestLoad(t *testing.T) {
+	db := open(t)
+	assert.Equal(t, 3, db.Len())
+	event, err := db.GetEventByID(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, "EiffelActivityTriggeredEvent", event.Type())
+	time, _ := event.Get("meta.time")
+	assert.Equal(t, int64(1000), time)
+
+	_, err = db.GetEventByID(context.Background(), "nah")
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+
+	empty, err := (&Driver{}).Get(context.Background(), &url.URL{Scheme: "memory"}, log.NewEntry(log.New()))
+	require.NoError(t, err)
+	assert.Equal(t, 0, empty.(*Database).Len())
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.ndjson"), []byte("{}\n{"), 0o644))
+	assert.ErrorContains(t, New(log.NewEntry(log.New())).Load(context.Background(), dir), "line 2")
+	assert.Error(t, New(log.NewEntry(log.New())).Load(context.Background(), filepath.Join(dir, "nah")))
+}
+
+// Test that events are filtered, sorted, paged and continued after a cursor.
+func TestGetEvents(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	conditions, err := query.Parse("nofile", []byte("int(meta.time)%3E=2000|meta.id=a"))
+	require.NoError(t, err)
+	sort := requests.Sort{{Field: "meta.time", Descending: true}}
+	request := requests.MultipleEventsRequest{PageNo: 1, PageSize: 2, Sort: sort, Conditions: conditions.([]query.Condition)}
+
+	events, total, err := db.GetEvents(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, ids(events))
+	assert.Equal(t, int64(3), total)
+
+	cursor, ok := drivers.CursorAfter(events[1], sort)
+	require.True(t, ok)
+	request.Cursor = cursor
+	events, total, err = db.GetEvents(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, ids(events))
+	assert.Equal(t, int64(3), total)
+
+	_, _, err = db.GetEvents(ctx, requests.MultipleEventsRequest{
+		Conditions: []query.Condition{{Field: "meta.time", Op: "=", Value: "nah", TypeConv: "int"}},
+	})
+	assert.Error(t, err)
+}
+
+// Test that links are followed upstream and downstream.
+func TestUpstreamDownstreamSearch(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	result, err := db.UpstreamDownstreamSearch(ctx, "b", requests.SearchRequest{
+		Limit:            -1,
+		Levels:           -1,
+		SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}, DLT: []string{"CAUSE"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "a"}, ids(result.Upstream))
+	assert.Equal(t, []string{"b", "c"}, ids(result.Downstream))
+
+	conditions, err := query.Parse("nofile", []byte("meta.id!=b"))
+	require.NoError(t, err)
+	result, err = db.UpstreamDownstreamSearch(ctx, "c", requests.SearchRequest{
+		Limit:            -1,
+		Levels:           -1,
+		SearchParameters: requests.SearchParameters{ULT: []string{"CAUSE"}},
+		Conditions:       conditions.([]query.Condition),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "a"}, ids(result.Upstream))
+	assert.Equal(t, []drivers.Edge{{Source: "c", Link: drivers.Link{Type: "CAUSE", Target: "a"}}}, result.UpstreamEdges)
+
+	result, err = db.UpstreamDownstreamSearch(ctx, "c", requests.SearchRequest{
+		Limit:            1,
+		Levels:           -1,
+		SearchParameters: requests.SearchParameters{ULT: []string{"CAUSE"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, ids(result.Upstream))
+
+	_, err = db.UpstreamDownstreamSearch(ctx, "nah", requests.SearchRequest{})
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+}
+
+// Test that the shortest path is found in either direction.
+func TestShortestPath(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	path, err := db.ShortestPath(ctx, requests.PathRequest{From: "c", To: "a", LinkTypes: []string{"ALL"}, Levels: -1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b", "a"}, ids(path.Events))
+
+	path, err = db.ShortestPath(ctx, requests.PathRequest{From: "a", To: "c", LinkTypes: []string{"CAUSE"}, Levels: -1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, ids(path.Events))
+
+	_, err = db.ShortestPath(ctx, requests.PathRequest{From: "a", To: "c", LinkTypes: []string{"CONTEXT"}, Levels: -1})
+	assert.ErrorIs(t, err, drivers.ErrPathNotFound)
+	_, err = db.ShortestPath(ctx, requests.PathRequest{From: "a", To: "nah", LinkTypes: []string{"ALL"}, Levels: -1})
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+}
+
+// Test that the memory driver conforms to the driver conformance test suite.
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, events []drivers.EiffelEvent) drivers.Database {
+		db := New(log.NewEntry(log.New()))
+		require.NoError(t, db.Insert(context.Background(), events...))
+		return db
+	})
+}
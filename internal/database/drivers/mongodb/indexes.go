@@ -0,0 +1,157 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// indexRefreshInterval is how often new collections, i.e. new event types, are indexed.
+const indexRefreshInterval = 5 * time.Minute
+
+// eventIndexes are the indexes created on every event collection. The index on meta.id
+// is unique, so that events that are published at the same time can't be stored twice.
+// Events only store their outgoing links, so the multikey index on links.target is a
+// reverse link index that makes it fast to find the events downstream of an event.
+var eventIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "meta.id", Value: 1}},
+		Options: options.Index().SetName("goer_meta_id").SetUnique(true),
+	},
+	{
+		Keys:    bson.D{{Key: "links.target", Value: 1}, {Key: "links.type", Value: 1}},
+		Options: options.Index().SetName("goer_links_target_type"),
+	},
+}
+
+// indexesParameter is the connection string parameter that turns off the creation of
+// indexes, e.g. mongodb://host/db?goerIndexes=false for a database user that can only
+// read. The indexes should then be created by other means.
+const indexesParameter = "goerIndexes"
+
+// indexesOption removes the indexesParameter from a connection URL, which MongoDB does
+// not know, and returns the URL without it and whether indexes are to be created.
+func indexesOption(connectionURL *url.URL) (*url.URL, bool, error) {
+	parameters := connectionURL.Query()
+	if !parameters.Has(indexesParameter) {
+		return connectionURL, true, nil
+	}
+	create, err := strconv.ParseBool(parameters.Get(indexesParameter))
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", indexesParameter, err)
+	}
+	parameters.Del(indexesParameter)
+	withoutParameter := *connectionURL
+	withoutParameter.RawQuery = parameters.Encode()
+	return &withoutParameter, create, nil
+}
+
+// EnsureIndexes creates the event indexes on all collections that have not been
+// indexed by this database connection. Creating an index that already exists
+// is a no-op in MongoDB, so this is safe to call for collections indexed earlier.
+// Collections that can't be indexed are logged and tried again on the next call.
+func (m *Database) EnsureIndexes(ctx context.Context) error {
+	collections, err := m.database.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	for _, collection := range m.unindexed(collections) {
+		m.logger.Debugf("creating indexes on collection %q", collection)
+		if err := createIndexes(ctx, m.database.Collection(collection).Indexes()); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			m.logger.Warnf("Database: failed to create indexes on collection %q: %v", collection, err)
+			continue
+		}
+		m.indexedMutex.Lock()
+		m.indexed[collection] = struct{}{}
+		m.indexedMutex.Unlock()
+	}
+	return nil
+}
+
+// unindexed returns the collections that have not been indexed by this database
+// connection, except for the system collections of MongoDB.
+func (m *Database) unindexed(collections []string) []string {
+	m.indexedMutex.Lock()
+	defer m.indexedMutex.Unlock()
+	var result []string
+	for _, collection := range collections {
+		if _, ok := m.indexed[collection]; ok || strings.HasPrefix(collection, "system.") {
+			continue
+		}
+		result = append(result, collection)
+	}
+	return result
+}
+
+// createIndexes creates the event indexes of a collection. Indexes with the same names
+// and other options, i.e. the indexes of earlier versions of Goer, are replaced.
+func createIndexes(ctx context.Context, indexes mongo.IndexView) error {
+	_, err := indexes.CreateMany(ctx, eventIndexes)
+	if !isIndexConflict(err) {
+		return err
+	}
+	for _, index := range eventIndexes {
+		if _, err := indexes.DropOne(ctx, *index.Options.Name); err != nil && !isIndexNotFound(err) {
+			return err
+		}
+	}
+	_, err = indexes.CreateMany(ctx, eventIndexes)
+	return err
+}
+
+// isIndexConflict tests whether an error is because an index already exists with the same
+// name or keys, but other options.
+func isIndexConflict(err error) bool {
+	var serverErr mongo.ServerError
+	// IndexOptionsConflict and IndexKeySpecsConflict.
+	return errors.As(err, &serverErr) && (serverErr.HasErrorCode(85) || serverErr.HasErrorCode(86))
+}
+
+// isIndexNotFound tests whether an error is because an index does not exist.
+func isIndexNotFound(err error) bool {
+	var serverErr mongo.ServerError
+	// IndexNotFound.
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(27)
+}
+
+// refreshIndexes calls EnsureIndexes once per interval until the context is done.
+func (m *Database) refreshIndexes(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.EnsureIndexes(ctx); err != nil && ctx.Err() == nil {
+			m.logger.Errorf("Database: failed to create indexes: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
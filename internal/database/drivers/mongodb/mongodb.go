@@ -24,7 +24,8 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"strconv"
+	"slices"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
@@ -45,7 +46,12 @@ type Driver struct {
 }
 
 // Get creates and connects a new database.Database interface against MongoDB.
+// The event collections are indexed unless the connection string has goerIndexes=false.
 func (d *Driver) Get(ctx context.Context, connectionURL *url.URL, logger *log.Entry) (drivers.Database, error) {
+	connectionURL, createIndexes, err := indexesOption(connectionURL)
+	if err != nil {
+		return nil, err
+	}
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionURL.String()))
 	if err != nil {
 		return nil, err
@@ -59,11 +65,23 @@ func (d *Driver) Get(ctx context.Context, connectionURL *url.URL, logger *log.En
 	if err := d.client.Ping(ctx, readpref.Primary()); err != nil {
 		return &Database{}, err
 	}
-	return &Database{
-		database: d.client.Database(d.connectionString.Database),
-		client:   d.client,
-		logger:   logger,
-	}, nil
+	database := &Database{
+		database:      d.client.Database(d.connectionString.Database),
+		client:        d.client,
+		logger:        logger,
+		createIndexes: createIndexes,
+		indexed:       make(map[string]struct{}),
+	}
+	if !createIndexes {
+		logger.Infof("Database: not creating indexes, since %s is false", indexesParameter)
+		return database, nil
+	}
+	// The indexes are refreshed for as long as the database is open, not only
+	// for as long as the context of this call.
+	refreshCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	database.stopRefresh = cancel
+	go database.refreshIndexes(refreshCtx, indexRefreshInterval)
+	return database, nil
 }
 
 // Test whether the MongoDB driver supports a scheme.
@@ -80,68 +98,159 @@ func (d *Driver) SupportsScheme(scheme string) bool {
 
 // Database is a connected database interface for requesting events from MongoDB.
 type Database struct {
-	database *mongo.Database
-	client   *mongo.Client
-	logger   *log.Entry
+	database      *mongo.Database
+	client        *mongo.Client
+	logger        *log.Entry
+	createIndexes bool
+	indexed       map[string]struct{}
+	indexedMutex  sync.Mutex
+	stopRefresh   context.CancelFunc
 }
 
 // operators is a translation table from query.Param to mongodb operators.
 var operators = map[string]string{
 	"=": "$eq", "!=": "$ne", ">": "$gt", "<": "$lt", "<=": "$lte", ">=": "$gte", "exists": "$exists",
+	query.OpIn: "$in", query.OpNotIn: "$nin",
 }
 
 // typeCast values in condition based on TypeConv parameter. Returns a bson Element.
 func typeCast(condition query.Condition) (bson.E, error) {
-	var err error
+	if condition.IsStringMatch() {
+		pattern, err := condition.Pattern()
+		return bson.E{Key: "$regex", Value: pattern}, err
+	}
 	e := bson.E{Key: operators[condition.Op]}
-	switch condition.TypeConv {
-	case "int":
-		e.Value, err = strconv.ParseInt(condition.Value, 0, 64)
-	case "double":
-		e.Value, err = strconv.ParseFloat(condition.Value, 64)
-	case "bool":
-		e.Value, err = strconv.ParseBool(condition.Value)
-	default:
-		e.Value = condition.Value
-		err = nil
+	if condition.Op == query.OpIn || condition.Op == query.OpNotIn {
+		values := make(bson.A, 0, len(condition.Values))
+		for _, value := range condition.Values {
+			v, err := query.CastValue(condition.TypeConv, value)
+			if err != nil {
+				return e, err
+			}
+			values = append(values, v)
+		}
+		e.Value = values
+		return e, nil
 	}
+	var err error
+	e.Value, err = query.CastValue(condition.TypeConv, condition.Value)
 	return e, err
 }
 
 // buildFilter creates a MongoDB filter based on query parameters.
 func buildFilter(conditions []query.Condition) (bson.D, error) {
 	d := bson.D{}
+	var fields []string
 	elements := map[string]bson.D{}
+	groups := bson.A{}
 	for _, condition := range conditions {
+		if condition.IsGroup() {
+			group, err := buildGroup(condition)
+			if err != nil {
+				return d, err
+			}
+			groups = append(groups, group)
+			continue
+		}
 		element, err := typeCast(condition)
 		if err != nil {
 			return d, err
 		}
+		if _, ok := elements[condition.Field]; !ok {
+			fields = append(fields, condition.Field)
+		}
+		// An operator can only be used once per field, so use a separate
+		// filter for e.g. two regular expressions on the same field.
+		if slices.ContainsFunc(elements[condition.Field], func(e bson.E) bool { return e.Key == element.Key }) {
+			groups = append(groups, bson.D{{Key: condition.Field, Value: bson.D{element}}})
+			continue
+		}
 		elements[condition.Field] = append(elements[condition.Field], element)
 	}
-	for key, values := range elements {
-		d = append(d, bson.E{Key: key, Value: values})
+	for _, key := range fields {
+		d = append(d, bson.E{Key: key, Value: elements[key]})
+	}
+	// Groups are added to an $and since there may be more than one $or.
+	if len(groups) > 0 {
+		d = append(d, bson.E{Key: "$and", Value: groups})
 	}
 	return d, nil
 }
 
+// buildGroup creates a MongoDB filter based on a group of query parameters.
+func buildGroup(group query.Condition) (bson.D, error) {
+	if group.Op == query.OpAnd {
+		return buildFilter(group.Conditions)
+	}
+	branches := bson.A{}
+	for _, condition := range group.Conditions {
+		branch, err := buildFilter([]query.Condition{condition})
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, branch)
+	}
+	return bson.D{{Key: "$or", Value: branches}}, nil
+}
+
 // collections are the collection names from MongoDB but filtered so that not all collections
 // are hammered every time we get events.
 func (m *Database) collections(ctx context.Context, filter bson.D) ([]string, error) {
-	typeConditions := m.findDValue(filter, "meta.type")
-	// meta.type not set, return all collections.
-	if typeConditions == nil {
-		return m.database.ListCollectionNames(ctx, bson.D{})
+	types := m.eventTypes(filter)
+	// meta.type not set to specific types, return all collections.
+	if types == nil {
+		// TODO: Collection filter
+		collections, err := m.database.ListCollectionNames(ctx, bson.D{})
+		// Sorted, so that lazy pages read the collections in the same order every time.
+		slices.Sort(collections)
+		return collections, err
 	}
+	return types, nil
+}
 
-	typeValue := m.findDValue(typeConditions.(bson.D), "$eq")
-	// No $eq. Apply collection filter to reduce the collection names
-	// request.
-	if typeValue == nil {
-		// TODO: Collection filter
-		return m.database.ListCollectionNames(ctx, bson.D{})
+// eventTypes returns the event types, which are also the collection names, that a filter
+// can match. Returns nil if the filter can match events of any type.
+func (m *Database) eventTypes(filter bson.D) []string {
+	if typeConditions, ok := m.findDValue(filter, "meta.type").(bson.D); ok {
+		if typeValue, ok := m.findDValue(typeConditions, "$eq").(string); ok {
+			return []string{typeValue}
+		}
+		if typeValues, ok := m.findDValue(typeConditions, "$in").(bson.A); ok {
+			types := make([]string, 0, len(typeValues))
+			for _, typeValue := range typeValues {
+				// No event type is named "", so there is no such collection.
+				if t, ok := typeValue.(string); ok && t != "" {
+					types = append(types, t)
+				}
+			}
+			slices.Sort(types)
+			return slices.Compact(types)
+		}
+	}
+	// An $or can match the event types of all its branches, if all of them are restricted.
+	if branches, ok := m.findDValue(filter, "$or").(bson.A); ok {
+		var types []string
+		for _, branch := range branches {
+			branchTypes := m.eventTypes(branch.(bson.D))
+			if branchTypes == nil {
+				types = nil
+				break
+			}
+			types = append(types, branchTypes...)
+		}
+		if types != nil {
+			slices.Sort(types)
+			return slices.Compact(types)
+		}
 	}
-	return []string{typeValue.(string)}, nil
+	// All groups in an $and must match, so any restricted group restricts the filter.
+	groups, _ := m.findDValue(filter, "$and").(bson.A)
+	for _, group := range groups {
+		if types := m.eventTypes(group.(bson.D)); types != nil {
+			return types
+		}
+	}
+	return nil
 }
 
 // findDValue walks through a bson.D and returns the value of the first matching key.
@@ -168,41 +277,314 @@ func (m *Database) GetEvents(ctx context.Context, request requests.MultipleEvent
 	}
 
 	m.logger.Debugf("fetching events from %d collections", len(collections))
+	page := m.page
+	if request.Lazy {
+		page = m.lazyPage
+	}
+	events, numberOfDocuments, err := page(ctx, collections, filter, request)
+	if err != nil {
+		m.logger.Errorf("Database: %v", err)
+		return nil, 0, err
+	}
+	return events, numberOfDocuments, nil
+}
+
+// page gets a page of events from all collections. The events of all collections are
+// ordered as one stream, by meta.id unless another order is requested, and the page is
+// cut from that stream. Each collection is sorted by MongoDB and read up to the end of
+// the page, so later pages are more expensive, but no events are skipped or repeated.
+func (m *Database) page(ctx context.Context, collections []string, filter bson.D, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+	order := drivers.OrderBy(request.Sort)
+	findFilter := filter
+	if !request.Cursor.IsZero() {
+		order = drivers.OrderBy(request.Cursor.Sort)
+		findFilter = bson.D{{Key: "$and", Value: bson.A{filter, keysetFilter(request.Cursor)}}}
+	}
+	skip := request.Skip()
+	end := skip + request.PageSize
 	allEvents := make([]drivers.EiffelEvent, 0, request.PageSize)
 	var numberOfDocuments int64
 	for _, collection := range collections {
+		col := m.database.Collection(collection)
+		count, err := col.CountDocuments(ctx, filter, &options.CountOptions{})
+		if err != nil {
+			return nil, 0, fmt.Errorf("counting events in %s: %w", collection, err)
+		}
+		numberOfDocuments += count
+		if count == 0 || end == 0 {
+			continue
+		}
+		findOptions := options.Find().
+			SetProjection(projection(request.Fields, order)).
+			SetSort(sortDocument(order)).
+			SetLimit(int64(end))
+		// With a single collection there is nothing to merge, so MongoDB can skip to the page.
+		if len(collections) == 1 {
+			findOptions.SetSkip(int64(skip)).SetLimit(int64(request.PageSize))
+		}
+		cursor, err := col.Find(ctx, findFilter, findOptions)
+		if err != nil {
+			return nil, 0, fmt.Errorf("fetching events from %s: %w", collection, err)
+		}
 		var events []drivers.EiffelEvent
-		limit := request.PageSize - len(allEvents)
+		if err = cursor.All(ctx, &events); err != nil {
+			return nil, 0, fmt.Errorf("fetching events from %s: %w", collection, err)
+		}
+		allEvents = append(allEvents, events...)
+	}
+	if len(collections) == 1 {
+		return allEvents, numberOfDocuments, nil
+	}
+	return drivers.Page(allEvents, order, skip, request.PageSize), numberOfDocuments, nil
+}
 
+// lazyPage gets a page of events by reading the collections one after another, each in
+// the requested order, until the page is full. The remaining collections are neither
+// read nor counted, so the number of documents is only the number of events up to the
+// end of the page, unless the last collection was reached.
+func (m *Database) lazyPage(ctx context.Context, collections []string, filter bson.D, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+	order := drivers.OrderBy(request.Sort)
+	skip := int64(request.Skip())
+	allEvents := make([]drivers.EiffelEvent, 0, request.PageSize)
+	var numberOfDocuments int64
+	for _, collection := range collections {
+		limit := request.PageSize - len(allEvents)
+		if limit <= 0 {
+			break
+		}
 		col := m.database.Collection(collection)
-		if limit > 0 {
-			cursor, err := col.Find(ctx, filter, options.Find().
-				SetProjection(bson.M{"_id": 0}).
-				SetSkip(int64((request.PageNo-1)*request.PageSize)).
-				SetLimit(int64(limit)),
-			)
-			if err != nil {
-				continue
-			}
-			if err = cursor.All(ctx, &events); err != nil {
-				m.logger.Info(err.Error())
-				continue
-			}
-			allEvents = append(allEvents, events...)
+		cursor, err := col.Find(ctx, filter, options.Find().
+			SetProjection(projection(request.Fields, order)).
+			SetSort(sortDocument(order)).
+			SetSkip(skip).
+			SetLimit(int64(limit)),
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("fetching events from %s: %w", collection, err)
 		}
-		if len(events) > 0 && len(events) < limit && request.PageNo == 1 {
-			numberOfDocuments += int64(len(events))
-		} else {
-			count, _ := col.CountDocuments(ctx, filter, &options.CountOptions{})
-			numberOfDocuments += count
+		var events []drivers.EiffelEvent
+		if err = cursor.All(ctx, &events); err != nil {
+			return nil, 0, fmt.Errorf("fetching events from %s: %w", collection, err)
 		}
+		allEvents = append(allEvents, events...)
+		numberOfDocuments += skip + int64(len(events))
+		if len(events) > 0 || skip == 0 {
+			skip = 0
+			continue
+		}
+		// The collection may have had fewer events than were left to skip. Counting
+		// is only needed then, to know how many of them to skip in the next collection.
+		count, err := col.CountDocuments(ctx, filter, &options.CountOptions{})
+		if err != nil {
+			return nil, 0, fmt.Errorf("counting events in %s: %w", collection, err)
+		}
+		numberOfDocuments += count - skip
+		skip -= count
 	}
 	return allEvents, numberOfDocuments, nil
 }
 
+// keysetFilter creates a filter for the events after the position of a cursor, i.e. the
+// events that are after the cursor on the first key, or equal on the first key and after
+// on the second key and so on. MongoDB only compares values of the same type, so events
+// where a key has a different type than in the cursor, other than missing, are not found.
+func keysetFilter(cursor requests.Cursor) bson.D {
+	branches := bson.A{}
+	equal := bson.D{}
+	for i, key := range drivers.OrderBy(cursor.Sort) {
+		value := cursor.After[i]
+		var after bson.E
+		switch {
+		case key.Descending && value == nil:
+			// Missing values are ordered first, so nothing is before them.
+		case key.Descending:
+			after = bson.E{Key: "$or", Value: bson.A{
+				bson.D{{Key: key.Field, Value: bson.D{{Key: "$lt", Value: value}}}},
+				bson.D{{Key: key.Field, Value: nil}},
+			}}
+		case value == nil:
+			after = bson.E{Key: key.Field, Value: bson.D{{Key: "$ne", Value: nil}}}
+		default:
+			after = bson.E{Key: key.Field, Value: bson.D{{Key: "$gt", Value: value}}}
+		}
+		if after.Key != "" {
+			branches = append(branches, append(slices.Clone(equal), after))
+		}
+		equal = append(equal, bson.E{Key: key.Field, Value: bson.D{{Key: "$eq", Value: value}}})
+	}
+	if len(branches) == 0 {
+		// $or must not be empty, so use a filter that matches nothing.
+		return bson.D{{Key: "$nor", Value: bson.A{bson.D{}}}}
+	}
+	return bson.D{{Key: "$or", Value: branches}}
+}
+
+// projection creates a MongoDB projection of the requested fields. The keys of the sort
+// order are also included, since they are needed to merge the events of all collections
+// and to create cursors. All fields are included if no fields are requested.
+func projection(fields requests.Fields, order requests.Sort) bson.D {
+	d := bson.D{{Key: "_id", Value: 0}}
+	if len(fields) == 0 {
+		return d
+	}
+	for _, key := range order {
+		fields = append(slices.Clip(fields), key.Field)
+	}
+	for _, field := range fields.Normalized() {
+		d = append(d, bson.E{Key: field, Value: 1})
+	}
+	return d
+}
+
+// sortDocument creates a MongoDB sort document from a sort order.
+func sortDocument(sort requests.Sort) bson.D {
+	d := make(bson.D, 0, len(sort))
+	for _, key := range sort {
+		direction := 1
+		if key.Descending {
+			direction = -1
+		}
+		d = append(d, bson.E{Key: key.Field, Value: direction})
+	}
+	return d
+}
+
+// graph finds events and follows links in the database for searches.
+func (m *Database) graph() drivers.Graph {
+	return drivers.Graph{
+		GetEventByID: m.GetEventByID,
+		Upstream:     m.upstreamEvents,
+		Downstream:   m.downstreamEvents,
+		Matching:     m.matching,
+		Logger:       m.logger,
+	}
+}
+
 // UpstreamDownstreamSearch searches for events upstream and/or downstream of event by ID.
-func (m *Database) UpstreamDownstreamSearch(_ context.Context, _ string) ([]drivers.EiffelEvent, error) {
-	return nil, errors.New("not yet implemented")
+func (m *Database) UpstreamDownstreamSearch(ctx context.Context, id string, request requests.SearchRequest) (drivers.SearchResult, error) {
+	return m.graph().UpstreamDownstreamSearch(ctx, id, request)
+}
+
+// ShortestPath finds the shortest chain of links from one event to another, following
+// the links either from the first event towards the second one or the other way around.
+func (m *Database) ShortestPath(ctx context.Context, request requests.PathRequest) (drivers.Path, error) {
+	return m.graph().ShortestPath(ctx, request)
+}
+
+// matching returns the IDs of the events that match all conditions.
+func (m *Database) matching(ctx context.Context, conditions []query.Condition, events []drivers.EiffelEvent) (map[string]struct{}, error) {
+	filter, err := buildFilter(conditions)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := m.collections(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID())
+	}
+	filter = bson.D{{Key: "$and", Value: bson.A{
+		filter,
+		bson.D{{Key: "meta.id", Value: bson.D{{Key: "$in", Value: ids}}}},
+	}}}
+
+	matches := make(map[string]struct{})
+	for _, collection := range collections {
+		var events []drivers.EiffelEvent
+		cursor, err := m.database.Collection(collection).Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 0, "meta.id": 1}))
+		if err != nil {
+			return nil, err
+		}
+		if err = cursor.All(ctx, &events); err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			matches[event.ID()] = struct{}{}
+		}
+	}
+	return matches, nil
+}
+
+// upstreamEvents finds the events that the events in frontier link to.
+func (m *Database) upstreamEvents(ctx context.Context, frontier []drivers.EiffelEvent, linkTypes []string) ([]drivers.EiffelEvent, error) {
+	ids := drivers.LinkTargets(frontier, linkTypes)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return m.find(ctx, bson.D{{Key: "meta.id", Value: bson.D{{Key: "$in", Value: ids}}}})
+}
+
+// downstreamEvents finds the events that link to the events in frontier, using the
+// reverse link index created by EnsureIndexes.
+func (m *Database) downstreamEvents(ctx context.Context, frontier []drivers.EiffelEvent, linkTypes []string) ([]drivers.EiffelEvent, error) {
+	ids := make([]string, 0, len(frontier))
+	for _, event := range frontier {
+		ids = append(ids, event.ID())
+	}
+	link := bson.D{{Key: "target", Value: bson.D{{Key: "$in", Value: ids}}}}
+	if !slices.Contains(linkTypes, requests.LinkTypeAll) {
+		link = append(link, bson.E{Key: "type", Value: bson.D{{Key: "$in", Value: linkTypes}}})
+	}
+	return m.find(ctx, bson.D{{Key: "links", Value: bson.D{{Key: "$elemMatch", Value: link}}}})
+}
+
+// find gets all events matching a filter from all collections that may contain them.
+func (m *Database) find(ctx context.Context, filter bson.D) ([]drivers.EiffelEvent, error) {
+	collections, err := m.collections(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var allEvents []drivers.EiffelEvent
+	for _, collection := range collections {
+		var events []drivers.EiffelEvent
+		cursor, err := m.database.Collection(collection).Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 0}))
+		if err != nil {
+			return nil, err
+		}
+		if err = cursor.All(ctx, &events); err != nil {
+			return nil, err
+		}
+		allEvents = append(allEvents, events...)
+	}
+	return allEvents, nil
+}
+
+// Insert stores events in the collections named after their meta.type. Events that are
+// already in their collection are left as they are. The collections are written one by
+// one without a transaction, which would need a replica set, so an error can leave some
+// of the events stored, but storing them again is safe.
+func (m *Database) Insert(ctx context.Context, events ...drivers.EiffelEvent) error {
+	models := make(map[string][]mongo.WriteModel)
+	for _, event := range events {
+		if event.ID() == "" || event.Type() == "" {
+			return errors.New("event has no meta.id or meta.type")
+		}
+		models[event.Type()] = append(models[event.Type()], mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "meta.id", Value: event.ID()}}).
+			SetUpdate(bson.D{{Key: "$setOnInsert", Value: bson.M(event)}}).
+			SetUpsert(true))
+	}
+	newCollections := false
+	for collection, writes := range models {
+		if _, err := m.database.Collection(collection).BulkWrite(ctx, writes); err != nil {
+			return err
+		}
+		m.indexedMutex.Lock()
+		_, ok := m.indexed[collection]
+		m.indexedMutex.Unlock()
+		newCollections = newCollections || !ok
+	}
+	// Index new event types right away instead of at the next refresh. The events are
+	// stored at this point, so a failure is left to the next refresh instead of failing
+	// the insert.
+	if newCollections && m.createIndexes {
+		if err := m.EnsureIndexes(ctx); err != nil {
+			m.logger.Errorf("Database: failed to create indexes: %v", err)
+		}
+	}
+	return nil
 }
 
 // GetEventByID gets an event by ID in all collections.
@@ -223,10 +605,13 @@ func (m *Database) GetEventByID(ctx context.Context, id string) (drivers.EiffelE
 		}
 		return drivers.EiffelEvent(event), nil
 	}
-	return nil, fmt.Errorf("%q not found in any collection", id)
+	return nil, fmt.Errorf("%q: %w in any collection", id, drivers.ErrEventNotFound)
 }
 
 // Close the database connection.
 func (m *Database) Close(ctx context.Context) error {
+	if m.stopRefresh != nil {
+		m.stopRefresh()
+	}
 	return m.client.Disconnect(ctx)
 }
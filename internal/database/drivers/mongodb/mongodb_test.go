@@ -0,0 +1,193 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package mongodb
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+	"github.com/eiffel-community/eiffel-goer/test/conformance"
+)
+
+// parse parses a query, failing the test on errors.
+func parse(t *testing.T, rawQuery string) []query.Condition {
+	t.Helper()
+	res, err := query.Parse("nofile", []byte(rawQuery))
+	require.NoError(t, err)
+	return res.([]query.Condition)
+}
+
+// Test that query conditions are translated into MongoDB filters.
+func TestBuildFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.D
+	}{
+		{
+			name:  "SameFieldIsMerged",
+			query: "int(meta.time)%3E1&int(meta.time)%3C=5&meta.type=A",
+			expected: bson.D{
+				{Key: "meta.time", Value: bson.D{{Key: "$gt", Value: int64(1)}, {Key: "$lte", Value: int64(5)}}},
+				{Key: "meta.type", Value: bson.D{{Key: "$eq", Value: "A"}}},
+			},
+		},
+		{
+			name:  "StringMatching",
+			query: "data.identity^=pkg:maven/my.namespace/&data.identity**=NAME",
+			expected: bson.D{
+				{Key: "data.identity", Value: bson.D{{Key: "$regex", Value: `^pkg:maven/my\.namespace/`}}},
+				{Key: "$and", Value: bson.A{
+					bson.D{{Key: "data.identity", Value: bson.D{{Key: "$regex", Value: "(?i)NAME"}}}},
+				}},
+			},
+		},
+		{
+			name:  "SetMembership",
+			query: "meta.type=in(A,B)&int(meta.time)!=in(1,2)",
+			expected: bson.D{
+				{Key: "meta.type", Value: bson.D{{Key: "$in", Value: bson.A{"A", "B"}}}},
+				{Key: "meta.time", Value: bson.D{{Key: "$nin", Value: bson.A{int64(1), int64(2)}}}},
+			},
+		},
+		{
+			name:  "Time",
+			query: "time(meta.time)%3E=2021-06-01T12:00:00%2B02:00&time(meta.time)%3C1622548800000",
+			expected: bson.D{
+				{Key: "meta.time", Value: bson.D{
+					{Key: "$gte", Value: int64(1622541600000)},
+					{Key: "$lt", Value: int64(1622548800000)},
+				}},
+			},
+		},
+		{
+			name:  "Or",
+			query: "data.name=x&(meta.type=A|meta.type=B&!data.value)",
+			expected: bson.D{
+				{Key: "data.name", Value: bson.D{{Key: "$eq", Value: "x"}}},
+				{Key: "$and", Value: bson.A{
+					bson.D{{Key: "$or", Value: bson.A{
+						bson.D{{Key: "meta.type", Value: bson.D{{Key: "$eq", Value: "A"}}}},
+						bson.D{{Key: "$and", Value: bson.A{bson.D{
+							{Key: "meta.type", Value: bson.D{{Key: "$eq", Value: "B"}}},
+							{Key: "data.value", Value: bson.D{{Key: "$exists", Value: false}}},
+						}}}},
+					}}},
+				}},
+			},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			filter, err := buildFilter(parse(t, testCase.query))
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, filter)
+		})
+	}
+}
+
+// Test that the event types, and thereby collections, that a filter can match are found.
+func TestEventTypes(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{query: "data.name=x", expected: nil},
+		{query: "meta.type=A", expected: []string{"A"}},
+		{query: "meta.type!=A", expected: nil},
+		{query: "meta.type=B|meta.type=A|meta.type=B", expected: []string{"A", "B"}},
+		{query: "meta.type=in(B,A,B)", expected: []string{"A", "B"}},
+		{query: "meta.type=in()", expected: []string{}},
+		{query: "meta.type!=in(A)", expected: nil},
+		{query: "meta.type=in(A,B)|meta.type=C", expected: []string{"A", "B", "C"}},
+		{query: "meta.type=A|data.name=x", expected: nil},
+		{query: "(meta.type=A|data.name=x)&(meta.type=B|meta.type=C&data.name=y)", expected: []string{"B", "C"}},
+	}
+
+	m := &Database{}
+	for _, testCase := range tests {
+		filter, err := buildFilter(parse(t, testCase.query))
+		require.NoError(t, err)
+		assert.Equalf(t, testCase.expected, m.eventTypes(filter), "query: %s", testCase.query)
+	}
+}
+
+// Test that the keyset filter of a cursor finds the events after it.
+func TestKeysetFilter(t *testing.T) {
+	cursor := requests.Cursor{
+		Sort:  requests.Sort{{Field: "meta.time", Descending: true}, {Field: "data.name"}},
+		After: []interface{}{int64(5), nil, "id"},
+	}
+	expected := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "meta.time", Value: bson.D{{Key: "$lt", Value: int64(5)}}}},
+			bson.D{{Key: "meta.time", Value: nil}},
+		}}},
+		bson.D{
+			{Key: "meta.time", Value: bson.D{{Key: "$eq", Value: int64(5)}}},
+			{Key: "data.name", Value: bson.D{{Key: "$ne", Value: nil}}},
+		},
+		bson.D{
+			{Key: "meta.time", Value: bson.D{{Key: "$eq", Value: int64(5)}}},
+			{Key: "data.name", Value: bson.D{{Key: "$eq", Value: nil}}},
+			{Key: "meta.id", Value: bson.D{{Key: "$gt", Value: "id"}}},
+		},
+	}}}
+	assert.Equal(t, expected, keysetFilter(cursor))
+}
+
+// Test that projections include the requested fields and the keys of the sort order.
+func TestProjection(t *testing.T) {
+	order := drivers.OrderBy(requests.Sort{{Field: "meta.time"}})
+	assert.Equal(t, bson.D{{Key: "_id", Value: 0}}, projection(nil, order))
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: 0},
+		{Key: "data", Value: 1},
+		{Key: "meta.id", Value: 1},
+		{Key: "meta.time", Value: 1},
+	}, projection(requests.Fields{"data", "meta.id", "data.identity"}, order))
+}
+
+// Test that the MongoDB driver conforms to the driver conformance test suite. The test
+// needs a MongoDB server and drops the database in GOER_TEST_MONGODB_URL, e.g.
+// mongodb://localhost:27017/goer-test.
+func TestConformance(t *testing.T) {
+	connectionString := os.Getenv("GOER_TEST_MONGODB_URL")
+	if connectionString == "" {
+		t.Skip("GOER_TEST_MONGODB_URL is not set")
+	}
+	conformance.Run(t, func(t *testing.T, events []drivers.EiffelEvent) drivers.Database {
+		ctx := context.Background()
+		connectionURL, err := url.Parse(connectionString)
+		require.NoError(t, err)
+		db, err := (&Driver{}).Get(ctx, connectionURL, log.NewEntry(log.New()))
+		require.NoError(t, err)
+		require.NoError(t, db.(*Database).database.Drop(ctx))
+		require.NoError(t, db.(*Database).Insert(ctx, events...))
+		return db
+	})
+}
@@ -0,0 +1,255 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package postgres
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// builder builds an SQL statement with positional arguments.
+type builder struct {
+	args []interface{}
+}
+
+// arg adds an argument and returns its placeholder.
+func (b *builder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// operators is a translation table from query.Param to JSON path operators.
+var operators = map[string]string{
+	"=": "==", "!=": "==", ">": ">", "<": "<", "<=": "<=", ">=": ">=", query.OpIn: "==", query.OpNotIn: "==",
+}
+
+// literal formats a value as a JSON path literal. JSON path strings and numbers
+// are written like in JSON.
+func literal(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+// fieldPath creates the JSON path of a dot separated field, e.g. $."meta"."type".
+func fieldPath(field string) string {
+	var path strings.Builder
+	path.WriteString("$")
+	for _, key := range strings.Split(field, ".") {
+		path.WriteString(".")
+		quoted, _ := literal(key)
+		path.WriteString(quoted)
+	}
+	return path.String()
+}
+
+// not negates a JSON path predicate. Comparisons of values of different types are
+// unknown, not false, so they are counted as not matching, which is how MongoDB
+// treats e.g. a != condition on a field of another type.
+func not(predicate string) string {
+	return fmt.Sprintf("(!(%s) || (%s) is unknown)", predicate, predicate)
+}
+
+// jsonPath translates a condition on a field into a JSON path predicate. Arrays are
+// unwrapped in the default lax mode, so a condition matches an array if it matches
+// any of its elements, as in MongoDB.
+func jsonPath(condition query.Condition) (string, error) {
+	path := fieldPath(condition.Field)
+	if condition.IsStringMatch() {
+		pattern, err := condition.Pattern()
+		if err != nil {
+			return "", err
+		}
+		flags := ""
+		if rest, ok := strings.CutPrefix(pattern, "(?i)"); ok {
+			pattern, flags = rest, ` flag "i"`
+		}
+		quoted, err := literal(pattern)
+		return path + " like_regex " + quoted + flags, err
+	}
+	if condition.Op == "exists" {
+		exists, err := query.CastValue(condition.TypeConv, condition.Value)
+		if err != nil {
+			return "", err
+		}
+		if exists == true {
+			return "exists(" + path + ")", nil
+		}
+		return "!exists(" + path + ")", nil
+	}
+	operator, ok := operators[condition.Op]
+	if !ok {
+		return "", fmt.Errorf("unsupported operator %q", condition.Op)
+	}
+	values := []string{condition.Value}
+	if condition.Op == query.OpIn || condition.Op == query.OpNotIn {
+		values = condition.Values
+	}
+	comparisons := make([]string, 0, len(values))
+	for _, value := range values {
+		v, err := query.CastValue(condition.TypeConv, value)
+		if err != nil {
+			return "", err
+		}
+		quoted, err := literal(v)
+		if err != nil {
+			return "", err
+		}
+		comparisons = append(comparisons, path+" "+operator+" "+quoted)
+	}
+	predicate := strings.Join(comparisons, " || ")
+	if len(comparisons) > 1 {
+		predicate = "(" + predicate + ")"
+	}
+	if condition.Op == "!=" || condition.Op == query.OpNotIn {
+		return not(predicate), nil
+	}
+	return predicate, nil
+}
+
+// where translates conditions that all must match into an SQL expression. Every
+// condition on a field is a JSON path match, which the GIN index on the events can
+// be used for.
+func (b *builder) where(conditions []query.Condition) (string, error) {
+	if len(conditions) == 0 {
+		return "TRUE", nil
+	}
+	expressions := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		expression, err := b.condition(condition)
+		if err != nil {
+			return "", err
+		}
+		expressions = append(expressions, expression)
+	}
+	return strings.Join(expressions, " AND "), nil
+}
+
+// condition translates a condition, which may be a group, into an SQL expression.
+func (b *builder) condition(condition query.Condition) (string, error) {
+	if condition.Op == query.OpAnd {
+		expression, err := b.where(condition.Conditions)
+		return "(" + expression + ")", err
+	}
+	if condition.Op == query.OpOr {
+		branches := make([]string, 0, len(condition.Conditions))
+		for _, branch := range condition.Conditions {
+			expression, err := b.condition(branch)
+			if err != nil {
+				return "", err
+			}
+			branches = append(branches, expression)
+		}
+		return "(" + strings.Join(branches, " OR ") + ")", nil
+	}
+	predicate, err := jsonPath(condition)
+	if err != nil {
+		return "", err
+	}
+	return "event @@ " + b.arg(predicate) + "::jsonpath", nil
+}
+
+// Type ranks of values, in the same order as drivers.CompareValues orders them.
+const (
+	rankMissing = 0
+	rankNumber  = 1
+	rankString  = 2
+	rankBoolean = 5
+)
+
+// sortExpressions returns the SQL expressions that order events by a field in the same
+// way as drivers.CompareValues, i.e. first by the type of the value and then by the value.
+// Strings are compared byte by byte, in the "C" collation. The field must be a valid sort
+// field, which consists of letters, digits and dots only.
+func sortExpressions(field string) (rank string, typed map[int]string) {
+	value := "(event #> '{" + strings.ReplaceAll(field, ".", ",") + "}')"
+	rank = "CASE jsonb_typeof(" + value + ") WHEN 'number' THEN 1 WHEN 'string' THEN 2" +
+		" WHEN 'object' THEN 3 WHEN 'array' THEN 4 WHEN 'boolean' THEN 5 ELSE 0 END"
+	typed = map[int]string{
+		rankNumber:  "(CASE WHEN jsonb_typeof(" + value + ") = 'number' THEN " + value + "::numeric END)",
+		rankString:  "(CASE WHEN jsonb_typeof(" + value + ") = 'string' THEN " + value + " #>> '{}' END) COLLATE \"C\"",
+		rankBoolean: "(CASE WHEN jsonb_typeof(" + value + ") = 'boolean' THEN " + value + "::boolean END)",
+	}
+	return rank, typed
+}
+
+// orderBy creates an SQL ORDER BY list from a sort order.
+func orderBy(sort requests.Sort) string {
+	var columns []string
+	for _, key := range sort {
+		direction := " ASC"
+		if key.Descending {
+			direction = " DESC"
+		}
+		rank, typed := sortExpressions(key.Field)
+		columns = append(columns, rank+direction)
+		for _, r := range []int{rankNumber, rankString, rankBoolean} {
+			columns = append(columns, typed[r]+direction)
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+// cursorRank returns the type rank and the SQL type of a value in a cursor.
+func cursorRank(value interface{}) (int, string) {
+	switch value.(type) {
+	case int64, float64:
+		return rankNumber, "numeric"
+	case string:
+		return rankString, "text"
+	case bool:
+		return rankBoolean, "boolean"
+	default:
+		return rankMissing, ""
+	}
+}
+
+// keyset creates an SQL expression for the events after the position of a cursor, i.e.
+// the events that are after the cursor on the first key, or equal on the first key and
+// after on the second key and so on, in the order created by orderBy.
+func (b *builder) keyset(cursor requests.Cursor) string {
+	var branches, equal []string
+	for i, key := range drivers.OrderBy(cursor.Sort) {
+		value := cursor.After[i]
+		rank, typed := sortExpressions(key.Field)
+		valueRank, sqlType := cursorRank(value)
+		after, before := ">", "<"
+		if key.Descending {
+			after, before = before, after
+		}
+		branch := fmt.Sprintf("%s %s %d", rank, after, valueRank)
+		equalKey := fmt.Sprintf("%s = %d", rank, valueRank)
+		if valueRank != rankMissing {
+			placeholder := b.arg(value) + "::" + sqlType
+			branch = fmt.Sprintf("(%s OR (%s AND %s %s %s))", branch, equalKey, typed[valueRank], after, placeholder)
+			equalKey = fmt.Sprintf("%s AND %s = %s", equalKey, typed[valueRank], placeholder)
+		}
+		// Missing values are ordered first, so nothing is before them.
+		if valueRank != rankMissing || !key.Descending {
+			branches = append(branches, "("+strings.Join(append(equal, branch), " AND ")+")")
+		}
+		equal = append(equal, equalKey)
+	}
+	if len(branches) == 0 {
+		return "FALSE"
+	}
+	return "(" + strings.Join(branches, " OR ") + ")"
+}
@@ -0,0 +1,252 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This package implements the database interface against PostgreSQL, where the
+// events are stored as JSONB documents in a single table.
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// Driver is a PostgreSQL database driver.
+type Driver struct{}
+
+// Get creates and connects a new database.Database interface against PostgreSQL.
+func (d *Driver) Get(ctx context.Context, connectionURL *url.URL, logger *log.Entry) (drivers.Database, error) {
+	pool, err := pgxpool.New(ctx, connectionURL.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	database := &Database{
+		pool:   pool,
+		logger: logger,
+	}
+	if err := database.EnsureSchema(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return database, nil
+}
+
+// Test whether the PostgreSQL driver supports a scheme.
+func (d *Driver) SupportsScheme(scheme string) bool {
+	switch scheme {
+	case "postgres":
+		return true
+	case "postgresql":
+		return true
+	default:
+		return false
+	}
+}
+
+// Database is a connected database interface for requesting events from PostgreSQL.
+type Database struct {
+	pool   *pgxpool.Pool
+	logger *log.Entry
+}
+
+// Insert stores events in the database. Events that are already in the database
+// are left as they are.
+func (p *Database) Insert(ctx context.Context, events ...drivers.EiffelEvent) error {
+	batch := &pgx.Batch{}
+	for _, event := range events {
+		if event.ID() == "" {
+			return errors.New("event has no meta.id")
+		}
+		document, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		batch.Queue("INSERT INTO events (event) VALUES ($1) ON CONFLICT (id) DO NOTHING", string(document))
+	}
+	// The statements of a batch run in one implicit transaction, so either all events
+	// are stored or none of them.
+	return p.pool.SendBatch(ctx, batch).Close()
+}
+
+// GetEvents gets all events information. The events are ordered by meta.id unless
+// another order is requested. Fields are not projected in the database, since the
+// handlers project the events.
+func (p *Database) GetEvents(ctx context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+	events, numberOfDocuments, err := p.page(ctx, request)
+	if err != nil {
+		p.logger.Errorf("Database: %v", err)
+		return nil, 0, err
+	}
+	return events, numberOfDocuments, nil
+}
+
+// page gets a page of events. All events are in one table, so lazy pages are the same
+// as other pages.
+func (p *Database) page(ctx context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+	b := &builder{}
+	filter, err := b.where(request.Conditions)
+	if err != nil {
+		return nil, 0, err
+	}
+	var numberOfDocuments int64
+	if err := p.pool.QueryRow(ctx, "SELECT count(*) FROM events WHERE "+filter, b.args...).Scan(&numberOfDocuments); err != nil {
+		return nil, 0, fmt.Errorf("counting events: %w", err)
+	}
+	order := drivers.OrderBy(request.Sort)
+	if !request.Cursor.IsZero() {
+		order = drivers.OrderBy(request.Cursor.Sort)
+		filter = filter + " AND " + b.keyset(request.Cursor)
+	}
+	statement := fmt.Sprintf("SELECT event FROM events WHERE %s ORDER BY %s OFFSET %s LIMIT %s",
+		filter, orderBy(order), b.arg(request.Skip()), b.arg(request.PageSize))
+	events, err := p.query(ctx, statement, b.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching events: %w", err)
+	}
+	return events, numberOfDocuments, nil
+}
+
+// query gets the events selected by an SQL statement.
+func (p *Database) query(ctx context.Context, statement string, args ...interface{}) ([]drivers.EiffelEvent, error) {
+	rows, err := p.pool.Query(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	documents, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, err
+	}
+	events := make([]drivers.EiffelEvent, 0, len(documents))
+	for _, document := range documents {
+		event, err := drivers.DecodeEvent(document)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// graph finds events and follows links in the database for searches.
+func (p *Database) graph() drivers.Graph {
+	return drivers.Graph{
+		GetEventByID: p.GetEventByID,
+		Upstream:     p.upstreamEvents,
+		Downstream:   p.downstreamEvents,
+		Matching:     p.matching,
+		Logger:       p.logger,
+	}
+}
+
+// UpstreamDownstreamSearch searches for events upstream and/or downstream of event by ID.
+func (p *Database) UpstreamDownstreamSearch(ctx context.Context, id string, request requests.SearchRequest) (drivers.SearchResult, error) {
+	return p.graph().UpstreamDownstreamSearch(ctx, id, request)
+}
+
+// ShortestPath finds the shortest chain of links from one event to another, following
+// the links either from the first event towards the second one or the other way around.
+func (p *Database) ShortestPath(ctx context.Context, request requests.PathRequest) (drivers.Path, error) {
+	return p.graph().ShortestPath(ctx, request)
+}
+
+// matching returns the IDs of the events that match all conditions.
+func (p *Database) matching(ctx context.Context, conditions []query.Condition, events []drivers.EiffelEvent) (map[string]struct{}, error) {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID())
+	}
+	b := &builder{}
+	filter, err := b.where(conditions)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.pool.Query(ctx, "SELECT id FROM events WHERE id = ANY("+b.arg(ids)+") AND "+filter, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	matchingIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	matches := make(map[string]struct{}, len(matchingIDs))
+	for _, id := range matchingIDs {
+		matches[id] = struct{}{}
+	}
+	return matches, nil
+}
+
+// downstreamStatement finds the events with links, of the link types in $3 or of any
+// type if $2 is true, to the events with the IDs in $1. The containment test uses the
+// reverse link index.
+const downstreamStatement = `
+	SELECT DISTINCT ON (events.id) events.event
+	FROM unnest($1::text[]) AS frontier(id)
+	JOIN events ON events.event -> 'links' @> jsonb_build_array(jsonb_build_object('target', frontier.id))
+	CROSS JOIN LATERAL jsonb_array_elements(events.event -> 'links') AS link
+	WHERE link ->> 'target' = frontier.id
+	AND ($2 OR link ->> 'type' = ANY($3))
+	ORDER BY events.id`
+
+// upstreamEvents finds the events that the events in frontier link to.
+func (p *Database) upstreamEvents(ctx context.Context, frontier []drivers.EiffelEvent, linkTypes []string) ([]drivers.EiffelEvent, error) {
+	ids := drivers.LinkTargets(frontier, linkTypes)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return p.query(ctx, "SELECT event FROM events WHERE id = ANY($1) ORDER BY id", ids)
+}
+
+// downstreamEvents finds the events that link to the events in frontier.
+func (p *Database) downstreamEvents(ctx context.Context, frontier []drivers.EiffelEvent, linkTypes []string) ([]drivers.EiffelEvent, error) {
+	ids := make([]string, 0, len(frontier))
+	for _, event := range frontier {
+		ids = append(ids, event.ID())
+	}
+	return p.query(ctx, downstreamStatement, ids, slices.Contains(linkTypes, requests.LinkTypeAll), linkTypes)
+}
+
+// GetEventByID gets an event by ID.
+func (p *Database) GetEventByID(ctx context.Context, id string) (drivers.EiffelEvent, error) {
+	events, err := p.query(ctx, "SELECT event FROM events WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%q: %w", id, drivers.ErrEventNotFound)
+	}
+	return events[0], nil
+}
+
+// Close the database connection.
+func (p *Database) Close(ctx context.Context) error {
+	p.pool.Close()
+	return nil
+}
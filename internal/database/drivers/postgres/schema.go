@@ -0,0 +1,44 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package postgres
+
+import (
+	"context"
+)
+
+// schema creates the events table and its indexes, unless they exist. The events are
+// stored as JSONB documents with their meta.id as primary key. The GIN index on the
+// events is used for the JSON path matches of all conditions and the GIN index on the
+// links is a reverse link index that makes it fast to find the events downstream of
+// an event.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS events (
+		id text GENERATED ALWAYS AS (event -> 'meta' ->> 'id') STORED PRIMARY KEY,
+		event jsonb NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS goer_events_event ON events USING GIN (event jsonb_path_ops)`,
+	`CREATE INDEX IF NOT EXISTS goer_events_links ON events USING GIN ((event -> 'links') jsonb_path_ops)`,
+}
+
+// EnsureSchema creates the events table and its indexes if they do not exist.
+func (p *Database) EnsureSchema(ctx context.Context) error {
+	for _, statement := range schema {
+		if _, err := p.pool.Exec(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
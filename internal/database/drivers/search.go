@@ -0,0 +1,166 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package drivers
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// LinkStep finds the events that are one link, of any of the given link types, away
+// from the events in frontier.
+type LinkStep func(ctx context.Context, frontier []EiffelEvent, linkTypes []string) ([]EiffelEvent, error)
+
+// Graph implements upstream/downstream searches and shortest paths for a database,
+// which only has to find events by ID, step along links and test conditions.
+type Graph struct {
+	// GetEventByID gets an event by ID.
+	GetEventByID func(ctx context.Context, id string) (EiffelEvent, error)
+	// Upstream finds the events that the events in a frontier link to.
+	Upstream LinkStep
+	// Downstream finds the events that link to the events in a frontier.
+	Downstream LinkStep
+	// Matching returns the IDs of the events that match all conditions.
+	Matching func(ctx context.Context, conditions []query.Condition, events []EiffelEvent) (map[string]struct{}, error)
+	// Logger logs the errors of walks and matching.
+	Logger *log.Entry
+}
+
+// UpstreamDownstreamSearch searches for events upstream and/or downstream of event by ID.
+func (g Graph) UpstreamDownstreamSearch(ctx context.Context, id string, request requests.SearchRequest) (SearchResult, error) {
+	start, err := g.GetEventByID(ctx, id)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	upstream, err := walk(ctx, start, request.ULT, request.Levels, request.Limit, "", g.Upstream)
+	if err != nil {
+		g.Logger.Errorf("Database: %v", err)
+		return SearchResult{}, err
+	}
+	downstream, err := walk(ctx, start, request.DLT, request.Levels, request.Limit, "", g.Downstream)
+	if err != nil {
+		g.Logger.Errorf("Database: %v", err)
+		return SearchResult{}, err
+	}
+	result := SearchResult{
+		Upstream:        upstream,
+		UpstreamEdges:   EdgesBetween(upstream, request.ULT),
+		Downstream:      downstream,
+		DownstreamEdges: EdgesBetween(downstream, request.DLT),
+	}
+	if len(request.Conditions) == 0 {
+		return result, nil
+	}
+	keep, err := g.Matching(ctx, request.Conditions, append(upstream, downstream...))
+	if err != nil {
+		g.Logger.Errorf("Database: %v", err)
+		return SearchResult{}, err
+	}
+	return result.Filter(keep), nil
+}
+
+// ShortestPath finds the shortest chain of links from one event to another, following
+// the links either from the first event towards the second one or the other way around.
+func (g Graph) ShortestPath(ctx context.Context, request requests.PathRequest) (Path, error) {
+	from, err := g.GetEventByID(ctx, request.From)
+	if err != nil {
+		return Path{}, err
+	}
+	if _, err = g.GetEventByID(ctx, request.To); err != nil {
+		return Path{}, err
+	}
+	for _, upstream := range []bool{true, false} {
+		step := g.Downstream
+		if upstream {
+			step = g.Upstream
+		}
+		events, err := walk(ctx, from, request.LinkTypes, request.Levels, -1, request.To, step)
+		if err != nil {
+			g.Logger.Errorf("Database: %v", err)
+			return Path{}, err
+		}
+		if path, ok := PathTo(events, EdgesBetween(events, request.LinkTypes), request.To, upstream); ok {
+			return path, nil
+		}
+	}
+	return Path{}, fmt.Errorf("%q to %q: %w", request.From, request.To, ErrPathNotFound)
+}
+
+// Filter removes the events that are not in keep, and the edges to them, from a search
+// result. See FilterEvents.
+func (r SearchResult) Filter(keep map[string]struct{}) SearchResult {
+	r.Upstream, r.UpstreamEdges = FilterEvents(r.Upstream, r.UpstreamEdges, keep, true)
+	r.Downstream, r.DownstreamEdges = FilterEvents(r.Downstream, r.DownstreamEdges, keep, false)
+	return r
+}
+
+// LinkTargets returns the IDs of the events that the events in frontier link to, with
+// any of the given link types.
+func LinkTargets(frontier []EiffelEvent, linkTypes []string) []string {
+	var ids []string
+	for _, event := range frontier {
+		for _, link := range event.Links() {
+			if MatchesLinkType(link.Type, linkTypes) {
+				ids = append(ids, link.Target)
+			}
+		}
+	}
+	return ids
+}
+
+// walk does a breadth-first walk from the start event, one level at a time, until
+// there are no more events to find, the levels or limit are reached or the event
+// with the ID until is found. A negative levels or limit means that there is no such
+// restriction and an empty until means that the walk does not stop at any event.
+// Events are only visited once, so cycles in bad data don't make a walk go on forever.
+func walk(
+	ctx context.Context, start EiffelEvent, linkTypes []string, levels, limit int, until string, step LinkStep,
+) ([]EiffelEvent, error) {
+	events := []EiffelEvent{start}
+	if len(linkTypes) == 0 {
+		return events, nil
+	}
+	visited := map[string]struct{}{start.ID(): {}}
+	frontier := events
+	for level := 0; len(frontier) > 0 && (levels < 0 || level < levels) && (limit < 0 || len(events) <= limit); level++ {
+		found, err := step(ctx, frontier, linkTypes)
+		if err != nil {
+			return nil, err
+		}
+		frontier = nil
+		for _, event := range found {
+			if _, ok := visited[event.ID()]; ok {
+				continue
+			}
+			// The start event does not count towards the limit.
+			if limit >= 0 && len(events) > limit {
+				return events, nil
+			}
+			visited[event.ID()] = struct{}{}
+			frontier = append(frontier, event)
+			events = append(events, event)
+			if until != "" && event.ID() == until {
+				return events, nil
+			}
+		}
+	}
+	return events, nil
+}
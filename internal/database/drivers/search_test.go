@@ -0,0 +1,77 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that walks stop at the levels, limit and until event without stepping further,
+// and that they end on cycles.
+func TestWalk(t *testing.T) {
+	// e1 -CAUSE-> e0, e2 -CAUSE-> e1 and so on, and e0 -CAUSE-> e9 in a cycle.
+	events := map[string]EiffelEvent{}
+	for i := 0; i < 10; i++ {
+		events[fmt.Sprintf("e%d", i)] = EiffelEvent{
+			"meta":  map[string]interface{}{"id": fmt.Sprintf("e%d", i)},
+			"links": []interface{}{map[string]interface{}{"type": "CAUSE", "target": fmt.Sprintf("e%d", (i+9)%10)}},
+		}
+	}
+	steps := 0
+	step := func(_ context.Context, frontier []EiffelEvent, linkTypes []string) ([]EiffelEvent, error) {
+		steps++
+		var found []EiffelEvent
+		for _, id := range LinkTargets(frontier, linkTypes) {
+			found = append(found, events[id])
+		}
+		return found, nil
+	}
+
+	tests := []struct {
+		name      string
+		linkTypes []string
+		levels    int
+		limit     int
+		until     string
+		expected  []string
+		steps     int
+	}{
+		{name: "All", linkTypes: []string{"CAUSE"}, levels: -1, limit: -1, expected: []string{"e5", "e4", "e3", "e2", "e1", "e0", "e9", "e8", "e7", "e6"}, steps: 10},
+		{name: "Levels", linkTypes: []string{"CAUSE"}, levels: 2, limit: -1, expected: []string{"e5", "e4", "e3"}, steps: 2},
+		{name: "Limit", linkTypes: []string{"CAUSE"}, levels: -1, limit: 3, expected: []string{"e5", "e4", "e3", "e2"}, steps: 3},
+		{name: "Until", linkTypes: []string{"CAUSE"}, levels: -1, limit: -1, until: "e3", expected: []string{"e5", "e4", "e3"}, steps: 2},
+		{name: "OtherLinkType", linkTypes: []string{"CONTEXT"}, levels: -1, limit: -1, expected: []string{"e5"}, steps: 1},
+		{name: "NoLinkTypes", levels: -1, limit: -1, expected: []string{"e5"}, steps: 0},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			steps = 0
+			found, err := walk(context.Background(), events["e5"], testCase.linkTypes, testCase.levels, testCase.limit, testCase.until, step)
+			require.NoError(t, err)
+			var ids []string
+			for _, event := range found {
+				ids = append(ids, event.ID())
+			}
+			assert.Equal(t, testCase.expected, ids)
+			assert.Equal(t, testCase.steps, steps)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package drivers
+
+import (
+	"cmp"
+	"reflect"
+	"slices"
+
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// OrderBy returns the sort order with meta.id added as a final key, unless already
+// present. Event IDs are unique, so events are then always in the same order even
+// when they have equal values for all requested keys.
+func OrderBy(sort requests.Sort) requests.Sort {
+	for _, key := range sort {
+		if key.Field == "meta.id" {
+			return sort
+		}
+	}
+	return append(slices.Clip(sort), requests.SortKey{Field: "meta.id"})
+}
+
+// SortEvents sorts events in the given order. Drivers that fetch events from several
+// sources sort each source in the database and use this to merge the results.
+func SortEvents(events []EiffelEvent, sort requests.Sort) {
+	slices.SortStableFunc(events, func(a, b EiffelEvent) int {
+		return CompareEvents(a, b, sort)
+	})
+}
+
+// Page sorts events in the given order and returns the pageSize events after the first
+// skip events. The page is empty if there are not enough events to reach it.
+func Page(events []EiffelEvent, sort requests.Sort, skip int, pageSize int) []EiffelEvent {
+	SortEvents(events, sort)
+	if skip < 0 || pageSize < 1 || skip >= len(events) {
+		return []EiffelEvent{}
+	}
+	return events[skip:min(skip+pageSize, len(events))]
+}
+
+// CursorAfter returns a cursor positioned right after an event in the given sort order.
+// Only numbers, strings, booleans and missing values can be stored in a cursor, so there
+// is no cursor after an event with an object or array value for one of the keys.
+func CursorAfter(event EiffelEvent, sort requests.Sort) (requests.Cursor, bool) {
+	order := OrderBy(sort)
+	cursor := requests.Cursor{Sort: sort, After: make([]interface{}, 0, len(order))}
+	for _, key := range order {
+		value, _ := event.Get(key.Field)
+		switch typeRank(value) {
+		case 3, 4, 6:
+			return requests.Cursor{}, false
+		}
+		cursor.After = append(cursor.After, value)
+	}
+	return cursor, true
+}
+
+// IsAfter tests whether an event is ordered after the position of a cursor.
+func IsAfter(event EiffelEvent, cursor requests.Cursor) bool {
+	for i, key := range OrderBy(cursor.Sort) {
+		if i >= len(cursor.After) {
+			break
+		}
+		value, _ := event.Get(key.Field)
+		c := CompareValues(value, cursor.After[i])
+		if key.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c > 0
+		}
+	}
+	return false
+}
+
+// CompareEvents compares two events by the keys of a sort order. It returns a negative
+// number when a is ordered before b, a positive number when a is ordered after b and
+// zero when they are equal on all keys.
+func CompareEvents(a, b EiffelEvent, sort requests.Sort) int {
+	for _, key := range sort {
+		aValue, _ := a.Get(key.Field)
+		bValue, _ := b.Get(key.Field)
+		c := CompareValues(aValue, bValue)
+		if key.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// typeRank ranks values of different types in the same order as MongoDB does:
+// missing values first, then numbers, strings, objects, arrays and booleans.
+func typeRank(value interface{}) int {
+	if value == nil {
+		return 0
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return 1
+	case reflect.String:
+		return 2
+	case reflect.Map:
+		return 3
+	case reflect.Slice, reflect.Array:
+		return 4
+	case reflect.Bool:
+		return 5
+	default:
+		return 6
+	}
+}
+
+// CompareValues compares two values of an event. Numbers of any type are compared
+// by value. Values of different types are ordered by type. Objects and arrays
+// are not compared any further.
+func CompareValues(a, b interface{}) int {
+	aRank, bRank := typeRank(a), typeRank(b)
+	if aRank != bRank {
+		return cmp.Compare(aRank, bRank)
+	}
+	switch aRank {
+	case 1:
+		// Compare integers as integers, since epoch nanoseconds and other large
+		// integers lose precision as floats.
+		if aInt, ok := toInt(a); ok {
+			if bInt, ok := toInt(b); ok {
+				return cmp.Compare(aInt, bInt)
+			}
+		}
+		return cmp.Compare(toFloat(a), toFloat(b))
+	case 2:
+		return cmp.Compare(reflect.ValueOf(a).String(), reflect.ValueOf(b).String())
+	case 5:
+		aBool, bBool := reflect.ValueOf(a).Bool(), reflect.ValueOf(b).Bool()
+		switch {
+		case aBool == bBool:
+			return 0
+		case aBool:
+			return 1
+		default:
+			return -1
+		}
+	default:
+		return 0
+	}
+}
+
+// toInt converts a value of a signed integer kind to an int64.
+func toInt(value interface{}) (int64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	default:
+		return 0, false
+	}
+}
+
+// toFloat converts a value of any numeric kind to a float64.
+func toFloat(value interface{}) float64 {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package drivers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+func sortEvent(id string, eventType string, time interface{}) EiffelEvent {
+	meta := EiffelEvent{"id": id, "type": eventType}
+	if time != nil {
+		meta["time"] = time
+	}
+	return EiffelEvent{"meta": meta}
+}
+
+func ids(events []EiffelEvent) []string {
+	var result []string
+	for _, event := range events {
+		result = append(result, event.ID())
+	}
+	return result
+}
+
+// Test that events are sorted by all keys, with meta.id breaking ties.
+func TestSortEvents(t *testing.T) {
+	events := []EiffelEvent{
+		sortEvent("a", "B", int64(2)),
+		sortEvent("b", "A", int32(3)),
+		sortEvent("c", "A", 2.5),
+		sortEvent("d", "A", nil),
+		sortEvent("e", "A", int64(2)),
+	}
+
+	SortEvents(events, OrderBy(requests.Sort{{Field: "meta.time", Descending: true}}))
+	assert.Equal(t, []string{"b", "c", "a", "e", "d"}, ids(events))
+
+	SortEvents(events, OrderBy(requests.Sort{{Field: "meta.type"}, {Field: "meta.time"}}))
+	assert.Equal(t, []string{"d", "e", "c", "b", "a"}, ids(events))
+
+	SortEvents(events, OrderBy(requests.Sort{{Field: "meta.id", Descending: true}}))
+	assert.Equal(t, []string{"e", "d", "c", "b", "a"}, ids(events))
+}
+
+// Test that pages are cut from the sorted events.
+func TestPage(t *testing.T) {
+	var events []EiffelEvent
+	for _, id := range []string{"e", "c", "a", "d", "b"} {
+		events = append(events, sortEvent(id, "A", nil))
+	}
+	order := OrderBy(nil)
+	assert.Equal(t, []string{"a", "b"}, ids(Page(events, order, 0, 2)))
+	assert.Equal(t, []string{"c", "d"}, ids(Page(events, order, 2, 2)))
+	assert.Equal(t, []string{"d", "e"}, ids(Page(events, order, 3, 2)))
+	assert.Equal(t, []string{"e"}, ids(Page(events, order, 4, 2)))
+	assert.Empty(t, Page(events, order, 5, 2))
+	assert.Empty(t, Page(events, order, -1, 2))
+	assert.Empty(t, Page(events, order, 0, 0))
+}
+
+// Test that cursors are positioned right after an event.
+func TestCursorAfter(t *testing.T) {
+	events := []EiffelEvent{
+		sortEvent("a", "A", int64(3)),
+		sortEvent("b", "A", int64(2)),
+		sortEvent("c", "A", nil),
+		sortEvent("d", "B", int64(2)),
+		sortEvent("e", "A", int64(2)),
+	}
+	sort := requests.Sort{{Field: "meta.time", Descending: true}}
+	SortEvents(events, OrderBy(sort))
+	require.Equal(t, []string{"a", "b", "d", "e", "c"}, ids(events))
+
+	for i, event := range events {
+		cursor, ok := CursorAfter(event, sort)
+		require.True(t, ok)
+		assert.Equal(t, sort, cursor.Sort)
+		for j, other := range events {
+			assert.Equalf(t, j > i, IsAfter(other, cursor), "%s after %s", other.ID(), event.ID())
+		}
+	}
+
+	_, ok := CursorAfter(EiffelEvent{"meta": EiffelEvent{"id": "a"}, "data": EiffelEvent{"x": 1}}, requests.Sort{{Field: "data"}})
+	assert.False(t, ok)
+}
+
+// Test that values of different types are ordered like in MongoDB.
+func TestCompareValues(t *testing.T) {
+	ordered := []interface{}{nil, int32(-1), 0.5, int64(1 << 60), int64(1<<60 + 1), "", "a", map[string]interface{}{}, []interface{}{}, false, true}
+	for i := range ordered {
+		for j := range ordered {
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			assert.Equalf(t, expected, CompareValues(ordered[i], ordered[j]), "%#v <=> %#v", ordered[i], ordered[j])
+		}
+	}
+	assert.Equal(t, 0, CompareValues(2, 2.0))
+}
+
+// Test that meta.id is only added to a sort order that does not have it.
+func TestOrderBy(t *testing.T) {
+	assert.Equal(t, requests.Sort{{Field: "meta.id"}}, OrderBy(nil))
+	byID := requests.Sort{{Field: "meta.id", Descending: true}, {Field: "meta.time"}}
+	assert.Equal(t, byID, OrderBy(byID))
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sqlite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// builder builds an SQL statement with numbered arguments.
+type builder struct {
+	args []interface{}
+}
+
+// arg adds an argument and returns its placeholder.
+func (b *builder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return "?" + strconv.Itoa(len(b.args))
+}
+
+// operators is a translation table from query.Param to SQL operators.
+var operators = map[string]string{
+	"=": "=", "!=": "=", ">": ">", "<": "<", "<=": "<=", ">=": ">=", query.OpIn: "=", query.OpNotIn: "=",
+}
+
+// jsonTypes returns the JSON types that a value is compared with, since values of
+// different types never match, and the value as an SQL value. Booleans are
+// integers in SQLite.
+func jsonTypes(value interface{}) (string, interface{}) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "'true', 'false'", int64(1)
+		}
+		return "'true', 'false'", int64(0)
+	case string:
+		return "'text'", v
+	default:
+		return "'integer', 'real'", v
+	}
+}
+
+// where translates conditions that all must match into an SQL expression.
+func (b *builder) where(conditions []query.Condition) (string, error) {
+	if len(conditions) == 0 {
+		return "TRUE", nil
+	}
+	expressions := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		expression, err := b.condition(condition)
+		if err != nil {
+			return "", err
+		}
+		expressions = append(expressions, expression)
+	}
+	return strings.Join(expressions, " AND "), nil
+}
+
+// condition translates a condition, which may be a group, into an SQL expression.
+// A condition on a field is tested on every element of the field if it is an array,
+// and matches if any element matches, as in MongoDB. Negated conditions match if
+// no element matches, which includes events that do not have the field.
+func (b *builder) condition(condition query.Condition) (string, error) {
+	switch condition.Op {
+	case query.OpAnd:
+		expression, err := b.where(condition.Conditions)
+		return "(" + expression + ")", err
+	case query.OpOr:
+		branches := make([]string, 0, len(condition.Conditions))
+		for _, branch := range condition.Conditions {
+			expression, err := b.condition(branch)
+			if err != nil {
+				return "", err
+			}
+			branches = append(branches, expression)
+		}
+		return "(" + strings.Join(branches, " OR ") + ")", nil
+	case "exists":
+		exists, err := query.CastValue(condition.TypeConv, condition.Value)
+		if err != nil {
+			return "", err
+		}
+		expression := fmt.Sprintf("EXISTS (SELECT 1 FROM json_tree(event, %s) AS element WHERE element.fullkey REGEXP %s)",
+			b.arg(rootPath(condition.Field)), b.arg(keyPattern(condition.Field, false)))
+		if exists == true {
+			return expression, nil
+		}
+		return "NOT " + expression, nil
+	}
+
+	var predicate string
+	if condition.IsStringMatch() {
+		pattern, err := condition.Pattern()
+		if err != nil {
+			return "", err
+		}
+		predicate = "element.type = 'text' AND element.value REGEXP " + b.arg(pattern)
+	} else {
+		operator, ok := operators[condition.Op]
+		if !ok {
+			return "", fmt.Errorf("unsupported operator %q", condition.Op)
+		}
+		values := []string{condition.Value}
+		if condition.Op == query.OpIn || condition.Op == query.OpNotIn {
+			values = condition.Values
+		}
+		comparisons := make([]string, 0, len(values))
+		for _, value := range values {
+			v, err := query.CastValue(condition.TypeConv, value)
+			if err != nil {
+				return "", err
+			}
+			types, sqlValue := jsonTypes(v)
+			comparisons = append(comparisons, fmt.Sprintf("(element.type IN (%s) AND element.value %s %s)", types, operator, b.arg(sqlValue)))
+		}
+		predicate = strings.Join(comparisons, " OR ")
+	}
+	expression := fmt.Sprintf("EXISTS (SELECT 1 FROM json_tree(event, %s) AS element WHERE element.fullkey REGEXP %s AND (%s))",
+		b.arg(rootPath(condition.Field)), b.arg(keyPattern(condition.Field, true)), predicate)
+	if condition.Op == "!=" || condition.Op == query.OpNotIn {
+		return "NOT " + expression, nil
+	}
+	return expression, nil
+}
+
+// jsonPath creates the SQLite JSON path of a dot separated field, e.g. $.meta.type.
+func jsonPath(field string) string {
+	return "$." + field
+}
+
+// rootPath creates the SQLite JSON path of the first key of a dot separated field,
+// which is where conditions start to search for the values of the field.
+func rootPath(field string) string {
+	return jsonPath(strings.Split(field, ".")[0])
+}
+
+// keyPattern creates a regular expression that matches the full keys, in json_tree, of
+// the values of a dot separated field. The keys of the field are found through arrays,
+// as in MongoDB, so links.type matches e.g. $.links[0].type. With elements, the keys of
+// the elements of an array value also match.
+func keyPattern(field string, elements bool) string {
+	const index = `(\[[0-9]+\])*`
+	keys := strings.Split(field, ".")
+	pattern := `^\$\.` + strings.Join(keys, index+`\.`)
+	if elements {
+		pattern += index
+	}
+	return pattern + "$"
+}
+
+// Type ranks of values, in the same order as drivers.CompareValues orders them.
+const (
+	rankMissing = 0
+	rankNumber  = 1
+	rankString  = 2
+	rankBoolean = 5
+)
+
+// sortExpressions returns the SQL expressions that order events by a field in the same
+// way as drivers.CompareValues, i.e. first by the type of the value and then by the value.
+// Strings are compared byte by byte, which is the default in SQLite. The field must be a
+// valid sort field, which consists of letters, digits and dots only.
+func sortExpressions(field string) (rank string, value string) {
+	path := "'" + jsonPath(field) + "'"
+	rank = "CASE json_type(event, " + path + ") WHEN 'integer' THEN 1 WHEN 'real' THEN 1 WHEN 'text' THEN 2" +
+		" WHEN 'object' THEN 3 WHEN 'array' THEN 4 WHEN 'true' THEN 5 WHEN 'false' THEN 5 ELSE 0 END"
+	value = "CASE WHEN json_type(event, " + path + ") IN ('integer', 'real', 'text', 'true', 'false')" +
+		" THEN json_extract(event, " + path + ") END"
+	return rank, value
+}
+
+// orderBy creates an SQL ORDER BY list from a sort order.
+func orderBy(sort requests.Sort) string {
+	var columns []string
+	for _, key := range sort {
+		direction := " ASC"
+		if key.Descending {
+			direction = " DESC"
+		}
+		rank, value := sortExpressions(key.Field)
+		columns = append(columns, rank+direction, value+direction)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// cursorRank returns the type rank of a value in a cursor and the value as an SQL value.
+func cursorRank(value interface{}) (int, interface{}) {
+	switch v := value.(type) {
+	case int64, float64:
+		return rankNumber, v
+	case string:
+		return rankString, v
+	case bool:
+		_, sqlValue := jsonTypes(v)
+		return rankBoolean, sqlValue
+	default:
+		return rankMissing, nil
+	}
+}
+
+// keyset creates an SQL expression for the events after the position of a cursor, i.e.
+// the events that are after the cursor on the first key, or equal on the first key and
+// after on the second key and so on, in the order created by orderBy.
+func (b *builder) keyset(cursor requests.Cursor) string {
+	var branches, equal []string
+	for i, key := range drivers.OrderBy(cursor.Sort) {
+		rank, value := sortExpressions(key.Field)
+		valueRank, sqlValue := cursorRank(cursor.After[i])
+		after := ">"
+		if key.Descending {
+			after = "<"
+		}
+		branch := fmt.Sprintf("%s %s %d", rank, after, valueRank)
+		equalKey := fmt.Sprintf("%s = %d", rank, valueRank)
+		if valueRank != rankMissing {
+			placeholder := b.arg(sqlValue)
+			branch = fmt.Sprintf("(%s OR (%s AND %s %s %s))", branch, equalKey, value, after, placeholder)
+			equalKey = fmt.Sprintf("%s AND %s = %s", equalKey, value, placeholder)
+		}
+		// Missing values are ordered first, so nothing is before them.
+		if valueRank != rankMissing || !key.Descending {
+			branches = append(branches, "("+strings.Join(append(equal, branch), " AND ")+")")
+		}
+		equal = append(equal, equalKey)
+	}
+	if len(branches) == 0 {
+		return "FALSE"
+	}
+	return "(" + strings.Join(branches, " OR ") + ")"
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sqlite
+
+import (
+	"context"
+)
+
+// schema creates the tables, indexes and triggers, unless they exist. The events are
+// stored as JSON text with their meta.id as primary key. The links of the events are
+// copied into the links table by triggers, whatever writes the events, so that links
+// can be followed in both directions with indexes.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS events (
+		id TEXT NOT NULL PRIMARY KEY,
+		event TEXT NOT NULL CHECK (json_valid(event))
+	)`,
+	`CREATE TABLE IF NOT EXISTS links (
+		source TEXT NOT NULL,
+		type TEXT NOT NULL,
+		target TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS goer_links_source ON links (source, type)`,
+	`CREATE INDEX IF NOT EXISTS goer_links_target ON links (target, type)`,
+	`CREATE TRIGGER IF NOT EXISTS goer_events_insert AFTER INSERT ON events BEGIN
+		INSERT INTO links (source, type, target)
+		SELECT NEW.id, coalesce(json_extract(link.value, '$.type'), ''), json_extract(link.value, '$.target')
+		FROM json_each(NEW.event, '$.links') AS link
+		WHERE link.type = 'object' AND json_type(link.value, '$.target') = 'text';
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS goer_events_delete AFTER DELETE ON events BEGIN
+		DELETE FROM links WHERE source = OLD.id;
+	END`,
+}
+
+// EnsureSchema creates the tables, indexes and triggers if they do not exist.
+func (s *Database) EnsureSchema(ctx context.Context) error {
+	for _, statement := range schema {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This package implements the database interface against an embedded SQLite
+// database file, for single-node deployments, development and tests.
+package sqlite
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	sqlitedriver "modernc.org/sqlite"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// pragmas are the default pragmas of the connections. Readers do not block the writer
+// in WAL mode and a busy database is waited for instead of failing at once.
+var pragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)"}
+
+// patterns caches the compiled patterns of the REGEXP operator, which is called for
+// every row that a statement compares. The patterns come from the queries of clients,
+// so only the most recently used ones are kept.
+var patterns = newPatternCache(256)
+
+// patternCache is a least recently used cache of compiled regular expressions.
+type patternCache struct {
+	mutex    sync.Mutex
+	capacity int
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+// newPatternCache creates a patternCache that keeps at most capacity patterns.
+func newPatternCache(capacity int) *patternCache {
+	return &patternCache{capacity: capacity, order: list.New(), elements: make(map[string]*list.Element)}
+}
+
+// compile returns a compiled pattern, from the cache if it has been compiled recently.
+func (c *patternCache) compile(pattern string) (*regexp.Regexp, error) {
+	c.mutex.Lock()
+	if element, ok := c.elements[pattern]; ok {
+		c.order.MoveToFront(element)
+		c.mutex.Unlock()
+		return element.Value.(*regexp.Regexp), nil
+	}
+	c.mutex.Unlock()
+	// Patterns are compiled without the lock, since compiling can be slow.
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.elements[pattern]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*regexp.Regexp), nil
+	}
+	c.elements[pattern] = c.order.PushFront(re)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.elements, oldest.Value.(*regexp.Regexp).String())
+	}
+	return re, nil
+}
+
+func init() {
+	// SQLite has a REGEXP operator but no implementation of it. The patterns of
+	// query.Condition are RE2 expressions, so Go's regexp package matches them.
+	sqlitedriver.MustRegisterDeterministicScalarFunction("regexp", 2,
+		func(ctx *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+			pattern, ok := args[0].(string)
+			if !ok {
+				return nil, errors.New("REGEXP pattern must be a string")
+			}
+			value, ok := args[1].(string)
+			if !ok {
+				return false, nil
+			}
+			re, err := patterns.compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString(value), nil
+		})
+}
+
+// Driver is an SQLite database driver.
+type Driver struct{}
+
+// Get opens, and creates if needed, an SQLite database file. The connection string is
+// sqlite://path/to/file.db for a relative path or sqlite:///path/to/file.db for an absolute
+// path. Query parameters, e.g. _pragma=synchronous(NORMAL), are passed on to SQLite.
+func (d *Driver) Get(ctx context.Context, connectionURL *url.URL, logger *log.Entry) (drivers.Database, error) {
+	path := connectionURL.Opaque
+	if path == "" {
+		path = connectionURL.Host + connectionURL.Path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no database file in %q", connectionURL.Redacted())
+	}
+	parameters := connectionURL.Query()
+	for _, pragma := range pragmas {
+		parameters.Add("_pragma", pragma)
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+parameters.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	database := &Database{
+		db:     db,
+		logger: logger,
+	}
+	if err := database.EnsureSchema(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return database, nil
+}
+
+// Test whether the SQLite driver supports a scheme.
+func (d *Driver) SupportsScheme(scheme string) bool {
+	return scheme == "sqlite"
+}
+
+// Database is a connected database interface for requesting events from SQLite.
+type Database struct {
+	db     *sql.DB
+	logger *log.Entry
+}
+
+// Insert stores events in the database. Events that are already in the database
+// are left as they are.
+func (s *Database) Insert(ctx context.Context, events ...drivers.EiffelEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, event := range events {
+		if event.ID() == "" {
+			return errors.New("event has no meta.id")
+		}
+		document, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO events (id, event) VALUES (?1, ?2) ON CONFLICT (id) DO NOTHING",
+			event.ID(), string(document)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetEvents gets all events information. The events are ordered by meta.id unless
+// another order is requested. Fields are not projected in the database, since the
+// handlers project the events.
+func (s *Database) GetEvents(ctx context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+	events, numberOfDocuments, err := s.page(ctx, request)
+	if err != nil {
+		s.logger.Errorf("Database: %v", err)
+		return nil, 0, err
+	}
+	return events, numberOfDocuments, nil
+}
+
+// page gets a page of events. All events are in one table, so lazy pages are the same
+// as other pages.
+func (s *Database) page(ctx context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+	b := &builder{}
+	filter, err := b.where(request.Conditions)
+	if err != nil {
+		return nil, 0, err
+	}
+	var numberOfDocuments int64
+	if err := s.db.QueryRowContext(ctx, "SELECT count(*) FROM events WHERE "+filter, b.args...).Scan(&numberOfDocuments); err != nil {
+		return nil, 0, fmt.Errorf("counting events: %w", err)
+	}
+	order := drivers.OrderBy(request.Sort)
+	if !request.Cursor.IsZero() {
+		order = drivers.OrderBy(request.Cursor.Sort)
+		filter = filter + " AND " + b.keyset(request.Cursor)
+	}
+	statement := fmt.Sprintf("SELECT event FROM events WHERE %s ORDER BY %s LIMIT %s OFFSET %s",
+		filter, orderBy(order), b.arg(request.PageSize), b.arg(request.Skip()))
+	events, err := s.query(ctx, statement, b.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetching events: %w", err)
+	}
+	return events, numberOfDocuments, nil
+}
+
+// query gets the events selected by an SQL statement.
+func (s *Database) query(ctx context.Context, statement string, args ...interface{}) ([]drivers.EiffelEvent, error) {
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []drivers.EiffelEvent
+	for rows.Next() {
+		var document []byte
+		if err := rows.Scan(&document); err != nil {
+			return nil, err
+		}
+		event, err := drivers.DecodeEvent(document)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// graph finds events and follows links in the database for searches.
+func (s *Database) graph() drivers.Graph {
+	return drivers.Graph{
+		GetEventByID: s.GetEventByID,
+		Upstream:     s.upstreamEvents,
+		Downstream:   s.downstreamEvents,
+		Matching:     s.matching,
+		Logger:       s.logger,
+	}
+}
+
+// UpstreamDownstreamSearch searches for events upstream and/or downstream of event by ID.
+func (s *Database) UpstreamDownstreamSearch(ctx context.Context, id string, request requests.SearchRequest) (drivers.SearchResult, error) {
+	return s.graph().UpstreamDownstreamSearch(ctx, id, request)
+}
+
+// ShortestPath finds the shortest chain of links from one event to another, following
+// the links either from the first event towards the second one or the other way around.
+func (s *Database) ShortestPath(ctx context.Context, request requests.PathRequest) (drivers.Path, error) {
+	return s.graph().ShortestPath(ctx, request)
+}
+
+// matching returns the IDs of the events that match all conditions.
+func (s *Database) matching(ctx context.Context, conditions []query.Condition, events []drivers.EiffelEvent) (map[string]struct{}, error) {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID())
+	}
+	encodedIDs, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	b := &builder{}
+	filter, err := b.where(conditions)
+	if err != nil {
+		return nil, err
+	}
+	statement := "SELECT id FROM events WHERE id IN (SELECT value FROM json_each(" + b.arg(string(encodedIDs)) + ")) AND " + filter
+	rows, err := s.db.QueryContext(ctx, statement, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	matches := make(map[string]struct{})
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		matches[id] = struct{}{}
+	}
+	return matches, rows.Err()
+}
+
+// upstreamEvents finds the events that the events in frontier link to.
+func (s *Database) upstreamEvents(ctx context.Context, frontier []drivers.EiffelEvent, linkTypes []string) ([]drivers.EiffelEvent, error) {
+	ids := drivers.LinkTargets(frontier, linkTypes)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	encodedIDs, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	return s.query(ctx, "SELECT event FROM events WHERE id IN (SELECT value FROM json_each(?1)) ORDER BY id", string(encodedIDs))
+}
+
+// downstreamEvents finds the events that link to the events in frontier, using the
+// index on the targets of the links.
+func (s *Database) downstreamEvents(ctx context.Context, frontier []drivers.EiffelEvent, linkTypes []string) ([]drivers.EiffelEvent, error) {
+	ids := make([]string, 0, len(frontier))
+	for _, event := range frontier {
+		ids = append(ids, event.ID())
+	}
+	encodedIDs, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	encodedTypes, err := json.Marshal(linkTypes)
+	if err != nil {
+		return nil, err
+	}
+	return s.query(ctx, `
+		SELECT event FROM events
+		WHERE id IN (
+			SELECT source FROM links
+			WHERE target IN (SELECT value FROM json_each(?1))
+			AND (?2 OR type IN (SELECT value FROM json_each(?3)))
+		)
+		ORDER BY id`,
+		string(encodedIDs), slices.Contains(linkTypes, requests.LinkTypeAll), string(encodedTypes))
+}
+
+// GetEventByID gets an event by ID.
+func (s *Database) GetEventByID(ctx context.Context, id string) (drivers.EiffelEvent, error) {
+	events, err := s.query(ctx, "SELECT event FROM events WHERE id = ?1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%q: %w", id, drivers.ErrEventNotFound)
+	}
+	return events[0], nil
+}
+
+// Close the database.
+func (s *Database) Close(ctx context.Context) error {
+	return s.db.Close()
+}
@@ -0,0 +1,282 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sqlite
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+	"github.com/eiffel-community/eiffel-goer/test/conformance"
+)
+
+// event creates an event with links of type CAUSE to the targets.
+func event(id string, eventType string, time int64, data map[string]interface{}, targets ...string) drivers.EiffelEvent {
+	links := []interface{}{}
+	for _, target := range targets {
+		links = append(links, map[string]interface{}{"type": "CAUSE", "target": target})
+	}
+	return drivers.EiffelEvent{
+		"meta":  map[string]interface{}{"id": id, "type": eventType, "time": time},
+		"data":  data,
+		"links": links,
+	}
+}
+
+// open creates a database in a temporary directory with a chain of events,
+// a <- b <- c, where c links to b and b links to a.
+func open(t *testing.T) *Database {
+	t.Helper()
+	ctx := context.Background()
+	connectionURL, err := url.Parse("sqlite://" + filepath.Join(t.TempDir(), "events.db"))
+	require.NoError(t, err)
+	db, err := (&Driver{}).Get(ctx, connectionURL, log.NewEntry(log.New()))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close(ctx) })
+	database := db.(*Database)
+	require.NoError(t, database.Insert(ctx,
+		event("a", "EiffelActivityTriggeredEvent", 1000, map[string]interface{}{"name": "Build", "tags": []interface{}{"x", "y"}}),
+		event("b", "EiffelActivityStartedEvent", 2000, map[string]interface{}{"n": 1.5}, "a"),
+		event("c", "EiffelActivityFinishedEvent", 3000, map[string]interface{}{"ok": true}, "b", "missing"),
+	))
+	return database
+}
+
+// ids returns the IDs of events.
+func ids(events []drivers.EiffelEvent) []string {
+	result := []string{}
+	for _, event := range events {
+		result = append(result, event.ID())
+	}
+	return result
+}
+
+// getEvents gets the IDs of the events that match a query, failing the test on errors.
+func getEvents(t *testing.T, db *Database, rawQuery string, request requests.MultipleEventsRequest) ([]string, int64) {
+	t.Helper()
+	if rawQuery != "" {
+		conditions, err := query.Parse("nofile", []byte(rawQuery))
+		require.NoError(t, err)
+		request.Conditions = conditions.([]query.Condition)
+	}
+	if request.PageNo == 0 {
+		request.PageNo, request.PageSize = 1, 10
+	}
+	events, total, err := db.GetEvents(context.Background(), request)
+	require.NoError(t, err)
+	return ids(events), total
+}
+
+// Test that the SQLite scheme is supported.
+func TestSupportsScheme(t *testing.T) {
+	driver := &Driver{}
+	assert.True(t, driver.SupportsScheme("sqlite"))
+	assert.False(t, driver.SupportsScheme("postgres"))
+}
+
+// Test that events are filtered by the conditions with MongoDB semantics.
+func TestGetEventsConditions(t *testing.T) {
+	db := open(t)
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"a", "b", "c"}},
+		{"meta.type=EiffelActivityStartedEvent", []string{"b"}},
+		{"meta.type!=EiffelActivityStartedEvent", []string{"a", "c"}},
+		{"int(meta.time)%3E=2000", []string{"b", "c"}},
+		{"meta.time%3E=2000", []string{}},
+		{"time(meta.time)%3C1970-01-01T00:00:02Z", []string{"a"}},
+		{"double(data.n)=1.5", []string{"b"}},
+		{"bool(data.ok)=true", []string{"c"}},
+		{"data.tags=y", []string{"a"}},
+		{"data.tags!=y", []string{"b", "c"}},
+		{"meta.id=in(a,c,nah)", []string{"a", "c"}},
+		{"meta.id!=in(a,c)", []string{"b"}},
+		{"data.name**=BUI", []string{"a"}},
+		{"data.name~=^B.*d$", []string{"a"}},
+		{"data.name^=build", []string{}},
+		{"data.ok", []string{"c"}},
+		{"!data.ok", []string{"a", "b"}},
+		{"meta.id=a|meta.id=b", []string{"a", "b"}},
+		{"(meta.id=a|meta.id=b)&int(meta.time)%3E1000", []string{"b"}},
+		{"data=Build", []string{}},
+		{"links.type=CAUSE", []string{"b", "c"}},
+		{"links.type!=CAUSE", []string{"a"}},
+		{"links.target=missing", []string{"c"}},
+		{"links.target", []string{"b", "c"}},
+		{"!links.target", []string{"a"}},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.query, func(t *testing.T) {
+			got, total := getEvents(t, db, testCase.query, requests.MultipleEventsRequest{})
+			assert.Equal(t, testCase.expected, got)
+			assert.Equal(t, int64(len(testCase.expected)), total)
+		})
+	}
+}
+
+// Test that the pattern cache keeps the most recently used patterns and no more.
+func TestPatternCache(t *testing.T) {
+	cache := newPatternCache(2)
+	a, err := cache.compile("a")
+	require.NoError(t, err)
+	_, err = cache.compile("b")
+	require.NoError(t, err)
+	again, err := cache.compile("a")
+	require.NoError(t, err)
+	assert.Same(t, a, again)
+
+	// b is the least recently used pattern, so it is the one that is dropped.
+	_, err = cache.compile("c")
+	require.NoError(t, err)
+	assert.Len(t, cache.elements, 2)
+	assert.Contains(t, cache.elements, "a")
+	assert.Contains(t, cache.elements, "c")
+	assert.NotContains(t, cache.elements, "b")
+
+	_, err = cache.compile("(")
+	assert.Error(t, err)
+	assert.Len(t, cache.elements, 2)
+}
+
+// Test that events are sorted, paged and continued after a cursor.
+func TestGetEventsPaging(t *testing.T) {
+	db := open(t)
+	sort := requests.Sort{{Field: "meta.time", Descending: true}}
+
+	got, total := getEvents(t, db, "", requests.MultipleEventsRequest{PageNo: 1, PageSize: 2, Sort: sort})
+	assert.Equal(t, []string{"c", "b"}, got)
+	assert.Equal(t, int64(3), total)
+
+	got, _ = getEvents(t, db, "", requests.MultipleEventsRequest{PageNo: 2, PageSize: 2, Sort: sort})
+	assert.Equal(t, []string{"a"}, got)
+
+	cursor, ok := drivers.CursorAfter(event("b", "", 2000, nil), sort)
+	require.True(t, ok)
+	got, total = getEvents(t, db, "", requests.MultipleEventsRequest{PageNo: 1, PageSize: 2, Cursor: cursor})
+	assert.Equal(t, []string{"a"}, got)
+	assert.Equal(t, int64(3), total)
+
+	// Events without the field are ordered first.
+	got, _ = getEvents(t, db, "", requests.MultipleEventsRequest{PageNo: 1, PageSize: 3, Sort: requests.Sort{{Field: "data.n"}}})
+	assert.Equal(t, []string{"a", "c", "b"}, got)
+}
+
+// Test that events are found by ID.
+func TestGetEventByID(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	got, err := db.GetEventByID(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, event("b", "EiffelActivityStartedEvent", 2000, map[string]interface{}{"n": 1.5}, "a"), got)
+
+	_, err = db.GetEventByID(ctx, "nah")
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+}
+
+// Test that links are followed upstream and downstream.
+func TestUpstreamDownstreamSearch(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	result, err := db.UpstreamDownstreamSearch(ctx, "b", requests.SearchRequest{
+		Limit:            -1,
+		Levels:           -1,
+		SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}, DLT: []string{"CAUSE"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "a"}, ids(result.Upstream))
+	assert.Equal(t, []string{"b", "c"}, ids(result.Downstream))
+	assert.Equal(t, []drivers.Edge{{Source: "c", Link: drivers.Link{Type: "CAUSE", Target: "b"}}}, result.DownstreamEdges)
+
+	result, err = db.UpstreamDownstreamSearch(ctx, "c", requests.SearchRequest{
+		Limit:            -1,
+		Levels:           1,
+		SearchParameters: requests.SearchParameters{ULT: []string{"CAUSE"}, DLT: []string{}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, ids(result.Upstream))
+	assert.Equal(t, []string{"c"}, ids(result.Downstream))
+
+	conditions, err := query.Parse("nofile", []byte("meta.id!=b"))
+	require.NoError(t, err)
+	result, err = db.UpstreamDownstreamSearch(ctx, "c", requests.SearchRequest{
+		Limit:            -1,
+		Levels:           -1,
+		SearchParameters: requests.SearchParameters{ULT: []string{"CAUSE"}},
+		Conditions:       conditions.([]query.Condition),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c", "a"}, ids(result.Upstream))
+	assert.Equal(t, []drivers.Edge{{Source: "c", Link: drivers.Link{Type: "CAUSE", Target: "a"}}}, result.UpstreamEdges)
+
+	_, err = db.UpstreamDownstreamSearch(ctx, "nah", requests.SearchRequest{})
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+}
+
+// Test that the shortest path is found in either direction.
+func TestShortestPath(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	path, err := db.ShortestPath(ctx, requests.PathRequest{From: "a", To: "c", LinkTypes: []string{"ALL"}, Levels: -1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, ids(path.Events))
+
+	_, err = db.ShortestPath(ctx, requests.PathRequest{From: "a", To: "c", LinkTypes: []string{"ALL"}, Levels: 1})
+	assert.ErrorIs(t, err, drivers.ErrPathNotFound)
+}
+
+// Test that links of events with unexpected links are ignored.
+func TestInsertBadLinks(t *testing.T) {
+	db := open(t)
+	ctx := context.Background()
+	require.NoError(t, db.Insert(ctx, drivers.EiffelEvent{
+		"meta":  map[string]interface{}{"id": "d"},
+		"links": map[string]interface{}{"type": "CAUSE", "target": "a"},
+	}))
+	require.NoError(t, db.Insert(ctx, drivers.EiffelEvent{
+		"meta":  map[string]interface{}{"id": "e"},
+		"links": []interface{}{"a", map[string]interface{}{"target": 1}},
+	}))
+	result, err := db.UpstreamDownstreamSearch(ctx, "a", requests.SearchRequest{
+		Limit:            -1,
+		Levels:           -1,
+		SearchParameters: requests.SearchParameters{DLT: []string{"ALL"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, ids(result.Downstream))
+	assert.Error(t, db.Insert(ctx, drivers.EiffelEvent{"meta": map[string]interface{}{}}))
+}
+
+// Test that the SQLite driver conforms to the driver conformance test suite.
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, events []drivers.EiffelEvent) drivers.Database {
+		connectionURL, err := url.Parse("sqlite://" + filepath.Join(t.TempDir(), "events.db"))
+		require.NoError(t, err)
+		db, err := (&Driver{}).Get(context.Background(), connectionURL, log.NewEntry(log.New()))
+		require.NoError(t, err)
+		require.NoError(t, db.(*Database).Insert(context.Background(), events...))
+		return db
+	})
+}
@@ -0,0 +1,376 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// federation combines the events of a database with the events of other event
+// repositories, such as other Goer instances or Eiffel Event Repositories, which
+// are queried over their REST APIs.
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// requestTimeout is the longest time to wait for a response from a repository.
+const requestTimeout = 30 * time.Second
+
+// Database is a database that also gets events from other event repositories when they
+// are not in the local database. The repositories are asked for shallow results, so that
+// repositories that are configured to ask each other do not do so endlessly.
+type Database struct {
+	local        drivers.Database
+	repositories []*url.URL
+	client       *http.Client
+	logger       *log.Entry
+}
+
+// New creates a database that gets events from the local database and the repositories,
+// given as base URLs of their REST APIs, e.g. "http://goer.example.com/v1".
+func New(local drivers.Database, repositories []string, logger *log.Entry) (*Database, error) {
+	db := &Database{
+		local:  local,
+		client: &http.Client{Timeout: requestTimeout},
+		logger: logger,
+	}
+	for _, repository := range repositories {
+		u, err := url.Parse(repository)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("upstream repository %q is not an HTTP URL", repository)
+		}
+		db.repositories = append(db.repositories, u)
+	}
+	return db, nil
+}
+
+// Local returns the local database.
+func (d *Database) Local() drivers.Database {
+	return d.local
+}
+
+// eventsResponse is the response of the events endpoint of a repository.
+type eventsResponse struct {
+	TotalNumberItems int64                 `json:"totalNumberItems"`
+	Items            []drivers.EiffelEvent `json:"items"`
+}
+
+// searchResponse is the response of the search endpoint of a repository.
+type searchResponse struct {
+	UpstreamLinkObjects   []drivers.EiffelEvent `json:"upstreamLinkObjects"`
+	DownstreamLinkObjects []drivers.EiffelEvent `json:"downstreamLinkObjects"`
+}
+
+// GetEvents gets events from the local database and all repositories. Every source is
+// asked for its events up to the end of the requested page, so that the page can be cut
+// from the merged events. Events that are in several sources are only included once,
+// but are counted once per source.
+func (d *Database) GetEvents(ctx context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+	skip := request.Skip()
+	sourceRequest := request
+	sourceRequest.PageNo = 1
+	sourceRequest.PageStartItem = 1
+	sourceRequest.PageSize = skip + request.PageSize
+	events, numberOfDocuments, err := d.local.GetEvents(ctx, sourceRequest)
+	if err != nil {
+		return nil, 0, err
+	}
+	found := make(map[string]struct{}, len(events))
+	for _, event := range events {
+		found[event.ID()] = struct{}{}
+	}
+	for _, repository := range d.repositories {
+		var response eventsResponse
+		ok, err := d.do(ctx, repository, http.MethodGet, "events", eventsQuery(sourceRequest), nil, &response)
+		if err != nil {
+			d.logger.Warnf("Federation: getting events from %s: %v", repository, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		numberOfDocuments += response.TotalNumberItems
+		for _, event := range response.Items {
+			if _, ok := found[event.ID()]; !ok {
+				found[event.ID()] = struct{}{}
+				events = append(events, event)
+			}
+		}
+	}
+	order := drivers.OrderBy(request.Sort)
+	if !request.Cursor.IsZero() {
+		order = drivers.OrderBy(request.Cursor.Sort)
+	}
+	return drivers.Page(events, order, skip, request.PageSize), numberOfDocuments, nil
+}
+
+// eventsQuery creates the query of an events request to a repository. The keys of
+// the sort order are added to the fields, since they are needed to merge the events.
+func eventsQuery(request requests.MultipleEventsRequest) string {
+	parameters := []string{"shallow=true", "pageNo=1", "pageSize=" + strconv.Itoa(request.PageSize)}
+	if request.Lazy {
+		parameters = append(parameters, "lazy=true")
+	}
+	if len(request.Sort) > 0 {
+		parameters = append(parameters, "sort="+url.QueryEscape(request.Sort.String()))
+	}
+	if !request.Cursor.IsZero() {
+		if token, err := request.Cursor.MarshalText(); err == nil {
+			parameters = append(parameters, "cursor="+string(token))
+		}
+	}
+	if len(request.Fields) > 0 {
+		fields := append(requests.Fields{}, request.Fields...)
+		for _, key := range drivers.OrderBy(request.Sort) {
+			fields = append(fields, key.Field)
+		}
+		parameters = append(parameters, "fields="+url.QueryEscape(strings.Join(fields.Normalized(), ",")))
+	}
+	if len(request.Conditions) > 0 {
+		parameters = append(parameters, query.Format(request.Conditions, "&"))
+	}
+	return strings.Join(parameters, "&")
+}
+
+// GetEventByID gets an event from the local database or, if it is not there, from the
+// first repository that has it.
+func (d *Database) GetEventByID(ctx context.Context, id string) (drivers.EiffelEvent, error) {
+	event, err := d.local.GetEventByID(ctx, id)
+	if !errors.Is(err, drivers.ErrEventNotFound) {
+		return event, err
+	}
+	for _, repository := range d.repositories {
+		var remote drivers.EiffelEvent
+		ok, remoteErr := d.do(ctx, repository, http.MethodGet, "events/"+url.PathEscape(id), "shallow=true", nil, &remote)
+		if remoteErr != nil {
+			d.logger.Warnf("Federation: getting event %s from %s: %v", id, repository, remoteErr)
+			continue
+		}
+		if ok {
+			return remote, nil
+		}
+	}
+	return nil, err
+}
+
+// UpstreamDownstreamSearch searches the local database and, if the event is not there,
+// the first repository that has it. Upstream link targets that are not in the local
+// database are searched for in the repositories, since local events often link to
+// events in a central repository. Downstream events are only searched for in the
+// database that has the event, since links can only be followed downstream with a
+// reverse link index.
+func (d *Database) UpstreamDownstreamSearch(ctx context.Context, id string, request requests.SearchRequest) (drivers.SearchResult, error) {
+	result, err := d.local.UpstreamDownstreamSearch(ctx, id, request)
+	if errors.Is(err, drivers.ErrEventNotFound) {
+		if remote, ok := d.searchRepositories(ctx, id, request); ok {
+			return remote, nil
+		}
+		return result, err
+	}
+	if err != nil {
+		return result, err
+	}
+	return d.resolveUpstream(ctx, id, result, request)
+}
+
+// resolveUpstream adds the events upstream of link targets that are not in the local
+// database to a search result, within the levels and limit of the search.
+func (d *Database) resolveUpstream(ctx context.Context, id string, result drivers.SearchResult, request requests.SearchRequest) (drivers.SearchResult, error) {
+	if len(request.ULT) == 0 || len(d.repositories) == 0 {
+		return result, nil
+	}
+	depths := upstreamDepths(id, result.UpstreamEdges)
+	found := make(map[string]struct{}, len(result.Upstream))
+	for _, event := range result.Upstream {
+		found[event.ID()] = struct{}{}
+	}
+	// Only the local events are checked for missing link targets, the events found in
+	// the repositories have already been searched upstream of.
+	localEvents := result.Upstream
+	for _, event := range localEvents {
+		depth, ok := depths[event.ID()]
+		if !ok || (request.Levels >= 0 && depth >= request.Levels) {
+			continue
+		}
+		for _, link := range event.Links() {
+			if _, ok := found[link.Target]; ok || !drivers.MatchesLinkType(link.Type, request.ULT) {
+				continue
+			}
+			// The start event does not count towards the limit.
+			if request.Limit >= 0 && len(result.Upstream)-1 >= request.Limit {
+				return result, nil
+			}
+			// The target may be local but left out by the conditions, levels or limit.
+			if _, err := d.local.GetEventByID(ctx, link.Target); !errors.Is(err, drivers.ErrEventNotFound) {
+				if err != nil {
+					return result, err
+				}
+				continue
+			}
+			targetRequest := requests.SearchRequest{
+				Limit:            -1,
+				Levels:           -1,
+				SearchParameters: requests.SearchParameters{ULT: request.ULT, DLT: []string{}},
+				Conditions:       request.Conditions,
+			}
+			if request.Levels >= 0 {
+				targetRequest.Levels = request.Levels - depth - 1
+			}
+			if request.Limit >= 0 {
+				targetRequest.Limit = request.Limit - len(result.Upstream)
+			}
+			remote, ok := d.searchRepositories(ctx, link.Target, targetRequest)
+			if !ok {
+				continue
+			}
+			for _, remoteEvent := range remote.Upstream {
+				if _, ok := found[remoteEvent.ID()]; ok {
+					continue
+				}
+				if request.Limit >= 0 && len(result.Upstream)-1 >= request.Limit {
+					break
+				}
+				found[remoteEvent.ID()] = struct{}{}
+				result.Upstream = append(result.Upstream, remoteEvent)
+			}
+			if _, ok := found[link.Target]; ok {
+				result.UpstreamEdges = append(result.UpstreamEdges, drivers.Edge{Source: event.ID(), Link: link})
+			}
+			for _, edge := range remote.UpstreamEdges {
+				_, sourceFound := found[edge.Source]
+				_, targetFound := found[edge.Target]
+				if sourceFound && targetFound {
+					result.UpstreamEdges = append(result.UpstreamEdges, edge)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// upstreamDepths returns the number of links from the start event to every event that
+// can be reached by following the edges from source to target.
+func upstreamDepths(start string, edges []drivers.Edge) map[string]int {
+	depths := map[string]int{start: 0}
+	frontier := []string{start}
+	for len(frontier) > 0 {
+		var next []string
+		for _, edge := range edges {
+			if _, ok := depths[edge.Target]; ok {
+				continue
+			}
+			for _, id := range frontier {
+				if edge.Source == id {
+					depths[edge.Target] = depths[id] + 1
+					next = append(next, edge.Target)
+					break
+				}
+			}
+		}
+		frontier = next
+	}
+	return depths
+}
+
+// searchRepositories does a search in the first repository that has the event.
+func (d *Database) searchRepositories(ctx context.Context, id string, request requests.SearchRequest) (drivers.SearchResult, bool) {
+	parameters := []string{"shallow=true"}
+	if request.Levels >= 0 {
+		parameters = append(parameters, "levels="+strconv.Itoa(request.Levels))
+	}
+	if request.Limit >= 0 {
+		parameters = append(parameters, "limit="+strconv.Itoa(request.Limit))
+	}
+	if len(request.Conditions) > 0 {
+		parameters = append(parameters, query.Format(request.Conditions, "&"))
+	}
+	for _, repository := range d.repositories {
+		var response searchResponse
+		ok, err := d.do(ctx, repository, http.MethodPost, "search/"+url.PathEscape(id), strings.Join(parameters, "&"), request.SearchParameters, &response)
+		if err != nil {
+			d.logger.Warnf("Federation: searching from %s in %s: %v", id, repository, err)
+			continue
+		}
+		if ok {
+			return drivers.SearchResult{
+				Upstream:        response.UpstreamLinkObjects,
+				UpstreamEdges:   drivers.EdgesBetween(response.UpstreamLinkObjects, request.ULT),
+				Downstream:      response.DownstreamLinkObjects,
+				DownstreamEdges: drivers.EdgesBetween(response.DownstreamLinkObjects, request.DLT),
+			}, true
+		}
+	}
+	return drivers.SearchResult{}, false
+}
+
+// ShortestPath finds the shortest path in the local database.
+func (d *Database) ShortestPath(ctx context.Context, request requests.PathRequest) (drivers.Path, error) {
+	return d.local.ShortestPath(ctx, request)
+}
+
+// Close closes the local database.
+func (d *Database) Close(ctx context.Context) error {
+	return d.local.Close(ctx)
+}
+
+// do sends a request to a repository and decodes the JSON response into v. The body,
+// if not nil, is sent as JSON. Returns false if the repository responds with 404 Not Found.
+func (d *Database) do(ctx context.Context, repository *url.URL, method string, path string, rawQuery string, body interface{}, v interface{}) (bool, error) {
+	u := repository.JoinPath(path)
+	u.RawQuery = rawQuery
+	var content bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&content).Encode(body); err != nil {
+			return false, err
+		}
+	}
+	request, err := http.NewRequestWithContext(ctx, method, u.String(), &content)
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := d.client.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, json.NewDecoder(response.Body).Decode(v)
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s %s: %s", method, u.Redacted(), response.Status)
+	}
+}
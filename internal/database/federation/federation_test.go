@@ -0,0 +1,227 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+	"github.com/eiffel-community/eiffel-goer/test/mock_drivers"
+)
+
+func event(id string, time int64, targets ...string) drivers.EiffelEvent {
+	links := []interface{}{}
+	for _, target := range targets {
+		links = append(links, map[string]interface{}{"type": "CAUSE", "target": target})
+	}
+	return drivers.EiffelEvent{
+		"meta":  map[string]interface{}{"id": id, "type": "EiffelActivityTriggeredEvent", "time": time},
+		"links": links,
+	}
+}
+
+// repository starts a stand-in for the REST API of another event repository.
+func repository(t *testing.T, handler http.HandlerFunc) string {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL + "/v1"
+}
+
+func respond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Test that only HTTP URLs are accepted as repositories.
+func TestNew(t *testing.T) {
+	logger := log.NewEntry(log.New())
+	_, err := New(nil, []string{"http://goer.example.com/v1", "https://er.example.com"}, logger)
+	assert.NoError(t, err)
+	_, err = New(nil, []string{"mongodb://localhost/db"}, logger)
+	assert.Error(t, err)
+	_, err = New(nil, []string{"http://%zz"}, logger)
+	assert.Error(t, err)
+}
+
+// Test that Local returns the local database, also through drivers.Local.
+func TestLocal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	db, err := New(mockDB, nil, log.NewEntry(log.New()))
+	assert.NoError(t, err)
+	assert.Equal(t, mockDB, db.Local())
+	assert.Equal(t, mockDB, drivers.Local(db))
+	assert.Equal(t, mockDB, drivers.Local(mockDB))
+}
+
+// Test that events that are not in the local database are fetched from the repositories.
+func TestGetEventByID(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	remote := event("remote", 1)
+	notFound := repository(t, http.NotFound)
+	failing := repository(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	found := repository(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/events/remote", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("shallow"))
+		respond(w, remote)
+	})
+	db, err := New(mockDB, []string{notFound, failing, found}, log.NewEntry(log.New()))
+	assert.NoError(t, err)
+
+	local := event("local", 1)
+	mockDB.EXPECT().GetEventByID(gomock.Any(), "local").Return(local, nil)
+	got, err := db.GetEventByID(ctx, "local")
+	assert.NoError(t, err)
+	assert.Equal(t, local, got)
+
+	mockDB.EXPECT().GetEventByID(gomock.Any(), "remote").Return(nil, drivers.ErrEventNotFound)
+	got, err = db.GetEventByID(ctx, "remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "remote", got.ID())
+
+	db.repositories = db.repositories[:2]
+	mockDB.EXPECT().GetEventByID(gomock.Any(), "missing").Return(nil, drivers.ErrEventNotFound)
+	_, err = db.GetEventByID(ctx, "missing")
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+}
+
+// Test that the events of the local database and the repositories are paged as one stream.
+func TestGetEvents(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	remote := repository(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/events", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("shallow"))
+		assert.Equal(t, "1", r.URL.Query().Get("pageNo"))
+		assert.Equal(t, "4", r.URL.Query().Get("pageSize"))
+		assert.Equal(t, "-meta.time", r.URL.Query().Get("sort"))
+		assert.Equal(t, "EiffelActivityTriggeredEvent", r.URL.Query().Get("meta.type"))
+		respond(w, eventsResponse{
+			TotalNumberItems: 3,
+			Items:            []drivers.EiffelEvent{event("r3", 3), event("l2", 2), event("r1", 1)},
+		})
+	})
+	db, err := New(mockDB, []string{remote}, log.NewEntry(log.New()))
+	assert.NoError(t, err)
+
+	request := requests.MultipleEventsRequest{
+		PageNo:   2,
+		PageSize: 2,
+		Sort:     requests.Sort{{Field: "meta.time", Descending: true}},
+		Conditions: []query.Condition{
+			{Field: "meta.type", Op: "=", Value: "EiffelActivityTriggeredEvent"},
+		},
+	}
+	mockDB.EXPECT().GetEvents(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+			assert.Equal(t, 1, request.PageNo)
+			assert.Equal(t, 4, request.PageSize)
+			return []drivers.EiffelEvent{event("l4", 4), event("l2", 2)}, 2, nil
+		})
+	events, total, err := db.GetEvents(ctx, request)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), total)
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.ID())
+	}
+	assert.Equal(t, []string{"l2", "r1"}, ids)
+}
+
+// Test that upstream link targets that are not in the local database are searched for
+// in the repositories.
+func TestUpstreamDownstreamSearch(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	remote := repository(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/search/r1", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("shallow"))
+		assert.Equal(t, "1", r.URL.Query().Get("levels"))
+		var parameters requests.SearchParameters
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&parameters))
+		assert.Equal(t, []string{"CAUSE"}, parameters.ULT)
+		assert.Empty(t, parameters.DLT)
+		respond(w, searchResponse{
+			UpstreamLinkObjects: []drivers.EiffelEvent{event("r1", 2, "r2"), event("r2", 1)},
+		})
+	})
+	db, err := New(mockDB, []string{remote}, log.NewEntry(log.New()))
+	assert.NoError(t, err)
+
+	request := requests.SearchRequest{
+		Limit:            -1,
+		Levels:           2,
+		SearchParameters: requests.SearchParameters{ULT: []string{"CAUSE"}, DLT: []string{"CAUSE"}},
+	}
+	start := event("start", 3, "r1")
+	mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), "start", request).Return(drivers.SearchResult{
+		Upstream:   []drivers.EiffelEvent{start},
+		Downstream: []drivers.EiffelEvent{start},
+	}, nil)
+	mockDB.EXPECT().GetEventByID(gomock.Any(), "r1").Return(nil, drivers.ErrEventNotFound)
+	result, err := db.UpstreamDownstreamSearch(ctx, "start", request)
+	assert.NoError(t, err)
+	assert.Len(t, result.Upstream, 3)
+	assert.Equal(t, []drivers.Edge{
+		{Source: "start", Link: drivers.Link{Type: "CAUSE", Target: "r1"}},
+		{Source: "r1", Link: drivers.Link{Type: "CAUSE", Target: "r2"}},
+	}, result.UpstreamEdges)
+	assert.Equal(t, []drivers.EiffelEvent{start}, result.Downstream)
+}
+
+// Test that a search from an event that is not in the local database is done in the
+// repositories.
+func TestUpstreamDownstreamSearchRemoteEvent(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	remote := repository(t, func(w http.ResponseWriter, r *http.Request) {
+		respond(w, searchResponse{
+			UpstreamLinkObjects:   []drivers.EiffelEvent{event("r1", 1)},
+			DownstreamLinkObjects: []drivers.EiffelEvent{event("r1", 1), event("r2", 2, "r1")},
+		})
+	})
+	db, err := New(mockDB, []string{remote}, log.NewEntry(log.New()))
+	assert.NoError(t, err)
+
+	request := requests.SearchRequest{
+		Limit:            -1,
+		Levels:           -1,
+		SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}, DLT: []string{"ALL"}},
+	}
+	mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), "r1", request).Return(drivers.SearchResult{}, drivers.ErrEventNotFound)
+	result, err := db.UpstreamDownstreamSearch(ctx, "r1", request)
+	assert.NoError(t, err)
+	assert.Len(t, result.Downstream, 2)
+	assert.Equal(t, []drivers.Edge{{Source: "r2", Link: drivers.Link{Type: "CAUSE", Target: "r1"}}}, result.DownstreamEdges)
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// graph renders the events and links found by a search as graphs in
+// text formats that can be used in other tools, such as Graphviz DOT,
+// GraphML and Mermaid.
+package graph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+)
+
+// Content types of the supported graph formats.
+const (
+	ContentTypeDOT     = "text/vnd.graphviz"
+	ContentTypeGraphML = "application/graphml+xml"
+	ContentTypeMermaid = "text/vnd.mermaid"
+)
+
+// ContentTypes are the content types of all supported graph formats.
+var ContentTypes = []string{ContentTypeDOT, ContentTypeGraphML, ContentTypeMermaid}
+
+// labelFields are the fields that are tried, in order, to find a short label for an event.
+var labelFields = []string{"data.name", "data.identity", "data.heading", "data.testCase.id", "data.value"}
+
+// Node is an event in a graph.
+type Node struct {
+	ID    string
+	Type  string
+	Label string
+	// Time is the meta.time of the event, in epoch milliseconds or as a readable time
+	// if the event has been made readable, or "" if the event has no time.
+	Time string
+}
+
+// Edge is a link from the event with ID From to the event with ID To.
+type Edge struct {
+	From string
+	To   string
+	Type string
+}
+
+type Graph struct {
+	Nodes []Node
+	Edges []Edge
+}
+
+// FromSearch creates a graph with all events and links in both directions of a search.
+func FromSearch(result drivers.SearchResult) Graph {
+	var graph Graph
+	added := make(map[string]struct{})
+	for _, event := range append(append([]drivers.EiffelEvent{}, result.Upstream...), result.Downstream...) {
+		if _, ok := added[event.ID()]; ok {
+			continue
+		}
+		added[event.ID()] = struct{}{}
+		graph.Nodes = append(graph.Nodes, Node{ID: event.ID(), Type: event.Type(), Label: label(event), Time: eventTime(event)})
+	}
+	for _, edge := range append(append([]drivers.Edge{}, result.UpstreamEdges...), result.DownstreamEdges...) {
+		graph.Edges = append(graph.Edges, Edge{From: edge.Source, To: edge.Target, Type: edge.Type})
+	}
+	return graph
+}
+
+// label returns a short label for an event, falling back to the start of its ID.
+func label(event drivers.EiffelEvent) string {
+	for _, field := range labelFields {
+		if value, ok := event.Get(field); ok {
+			if s, ok := value.(string); ok && s != "" {
+				return s
+			}
+		}
+	}
+	id := event.ID()
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// eventTime returns the meta.time of an event as text.
+func eventTime(event drivers.EiffelEvent) string {
+	value, _ := event.Get("meta.time")
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// Render renders the graph in the format of one of the ContentTypes.
+func (g Graph) Render(contentType string) ([]byte, error) {
+	switch contentType {
+	case ContentTypeDOT:
+		return g.DOT(), nil
+	case ContentTypeGraphML:
+		return g.GraphML()
+	case ContentTypeMermaid:
+		return g.Mermaid(), nil
+	default:
+		return nil, fmt.Errorf("unsupported graph content type %q", contentType)
+	}
+}
+
+// DOT renders the graph as a Graphviz DOT digraph.
+func (g Graph) DOT() []byte {
+	var b bytes.Buffer
+	b.WriteString("digraph events {\n")
+	for _, node := range g.Nodes {
+		attributes := "label=" + dotQuote(node.Type+"\n"+node.Label)
+		if node.Time != "" {
+			attributes += ", time=" + dotQuote(node.Time)
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(node.ID), attributes)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Type))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// dotQuote quotes a DOT ID, escaping characters that have special meaning in quoted IDs.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// Mermaid renders the graph as a Mermaid flowchart.
+func (g Graph) Mermaid() []byte {
+	var b bytes.Buffer
+	b.WriteString("flowchart LR\n")
+	// Event IDs contain dashes, which Mermaid confuses with links, so number the nodes instead.
+	ids := make(map[string]string, len(g.Nodes))
+	for i, node := range g.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "  %s[\"%s<br/>%s\"]\n", ids[node.ID], mermaidEscape(node.Type), mermaidEscape(node.Label))
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %s -->|%s| %s\n", ids[edge.From], mermaidEscape(edge.Type), ids[edge.To])
+	}
+	return b.Bytes()
+}
+
+// mermaidEscape replaces characters that would end a Mermaid label with entity codes.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;", "<", "#lt;", ">", "#gt;", "\n", " ").Replace(s)
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+// GraphML renders the graph as a GraphML document.
+func (g Graph) GraphML() ([]byte, error) {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "type", For: "node", AttrName: "type", AttrType: "string"},
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "time", For: "node", AttrName: "time", AttrType: "string"},
+			{ID: "linkType", For: "edge", AttrName: "linkType", AttrType: "string"},
+		},
+	}
+	doc.Graph.EdgeDefault = "directed"
+	for _, node := range g.Nodes {
+		data := []graphMLData{{Key: "type", Value: node.Type}, {Key: "label", Value: node.Label}}
+		if node.Time != "" {
+			data = append(data, graphMLData{Key: "time", Value: node.Time})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node.ID, Data: data})
+	}
+	for _, edge := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: edge.From,
+			Target: edge.To,
+			Data:   []graphMLData{{Key: "linkType", Value: edge.Type}},
+		})
+	}
+	content, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package graph
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+)
+
+var (
+	artifact = drivers.EiffelEvent{
+		"meta": map[string]interface{}{"id": "3fabaa6b-5343-4d74-8af9-dc2e4c1f2827", "type": "EiffelArtifactCreatedEvent"},
+		"data": map[string]interface{}{"identity": `pkg:maven/"my"/name@1.0.0`},
+	}
+	activity = drivers.EiffelEvent{
+		"meta": map[string]interface{}{"id": "e04cf9d3-4d57-471e-bd65-f8fc20d21d84", "type": "EiffelActivityTriggeredEvent", "time": int64(1629449650361)},
+	}
+	result = drivers.SearchResult{
+		Upstream:      []drivers.EiffelEvent{artifact, activity},
+		UpstreamEdges: []drivers.Edge{{Source: artifact.ID(), Link: drivers.Link{Type: "CAUSE", Target: activity.ID()}}},
+		Downstream:    []drivers.EiffelEvent{artifact},
+	}
+)
+
+// Test that a search result is turned into a graph without duplicated nodes.
+func TestFromSearch(t *testing.T) {
+	assert.Equal(t, Graph{
+		Nodes: []Node{
+			{ID: artifact.ID(), Type: "EiffelArtifactCreatedEvent", Label: `pkg:maven/"my"/name@1.0.0`},
+			{ID: activity.ID(), Type: "EiffelActivityTriggeredEvent", Label: "e04cf9d3", Time: "1629449650361"},
+		},
+		Edges: []Edge{{From: artifact.ID(), To: activity.ID(), Type: "CAUSE"}},
+	}, FromSearch(result))
+}
+
+// Test that graphs are rendered as DOT with escaped labels.
+func TestDOT(t *testing.T) {
+	content, err := FromSearch(result).Render(ContentTypeDOT)
+	require.NoError(t, err)
+	assert.Equal(t, `digraph events {
+  "3fabaa6b-5343-4d74-8af9-dc2e4c1f2827" [label="EiffelArtifactCreatedEvent\npkg:maven/\"my\"/name@1.0.0"];
+  "e04cf9d3-4d57-471e-bd65-f8fc20d21d84" [label="EiffelActivityTriggeredEvent\ne04cf9d3", time="1629449650361"];
+  "3fabaa6b-5343-4d74-8af9-dc2e4c1f2827" -> "e04cf9d3-4d57-471e-bd65-f8fc20d21d84" [label="CAUSE"];
+}
+`, string(content))
+}
+
+// Test that graphs are rendered as Mermaid flowcharts with escaped labels.
+func TestMermaid(t *testing.T) {
+	content, err := FromSearch(result).Render(ContentTypeMermaid)
+	require.NoError(t, err)
+	assert.Equal(t, `flowchart LR
+  n0["EiffelArtifactCreatedEvent<br/>pkg:maven/#quot;my#quot;/name@1.0.0"]
+  n1["EiffelActivityTriggeredEvent<br/>e04cf9d3"]
+  n0 -->|CAUSE| n1
+`, string(content))
+}
+
+// Test that graphs are rendered as valid GraphML.
+func TestGraphML(t *testing.T) {
+	content, err := FromSearch(result).Render(ContentTypeGraphML)
+	require.NoError(t, err)
+	var doc graphML
+	require.NoError(t, xml.Unmarshal(content, &doc))
+	assert.Equal(t, "directed", doc.Graph.EdgeDefault)
+	require.Len(t, doc.Graph.Nodes, 2)
+	assert.Equal(t, []graphMLData{
+		{Key: "type", Value: "EiffelArtifactCreatedEvent"},
+		{Key: "label", Value: `pkg:maven/"my"/name@1.0.0`},
+	}, doc.Graph.Nodes[0].Data)
+	assert.Contains(t, doc.Graph.Nodes[1].Data, graphMLData{Key: "time", Value: "1629449650361"})
+	require.Len(t, doc.Graph.Edges, 1)
+	assert.Equal(t, graphMLEdge{
+		Source: artifact.ID(),
+		Target: activity.ID(),
+		Data:   []graphMLData{{Key: "linkType", Value: "CAUSE"}},
+	}, doc.Graph.Edges[0])
+}
+
+// Test that the times of readable events are kept as they are.
+func TestReadableTime(t *testing.T) {
+	graph := FromSearch(drivers.SearchResult{Upstream: []drivers.EiffelEvent{activity.Readable()}})
+	require.Len(t, graph.Nodes, 1)
+	assert.Equal(t, "2021-08-20T08:54:10.361Z", graph.Nodes[0].Time)
+
+	graph = FromSearch(drivers.SearchResult{Upstream: []drivers.EiffelEvent{{"meta": map[string]interface{}{"time": 1.5e12}}}})
+	assert.Equal(t, "1500000000000", graph.Nodes[0].Time)
+}
+
+// Test that unsupported content types are rejected.
+func TestRenderUnsupported(t *testing.T) {
+	_, err := FromSearch(result).Render("image/png")
+	assert.Error(t, err)
+}
@@ -20,11 +20,188 @@ package query
 
 //go:generate pigeon -o query.go query.peg
 
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Logical operators of conditions that are groups of other conditions.
+const (
+	OpOr  = "or"
+	OpAnd = "and"
+)
+
+// String matching operators. The operators with a '*' before the '=' are
+// case-insensitive variants.
+const (
+	OpRegex              = "~="
+	OpRegexIgnoreCase    = "~*="
+	OpPrefix             = "^="
+	OpPrefixIgnoreCase   = "^*="
+	OpContains           = "*="
+	OpContainsIgnoreCase = "**="
+)
+
+// Set membership operators, which have Values instead of a Value.
+const (
+	OpIn    = "in"
+	OpNotIn = "notin"
+)
+
+// Condition is a condition on a field, such as "meta.type=EiffelActivityTriggeredEvent",
+// or, if Op is OpOr or OpAnd, a group where any or all Conditions must match.
 type Condition struct {
-	Field    string
-	Op       string
-	Value    string
-	TypeConv string
+	Field      string
+	Op         string
+	Value      string
+	Values     []string
+	TypeConv   string
+	Conditions []Condition
+}
+
+// IsGroup tests whether the condition is a group of other conditions.
+func (c Condition) IsGroup() bool {
+	return c.Op == OpOr || c.Op == OpAnd
+}
+
+// IsStringMatch tests whether the condition uses one of the string matching operators.
+func (c Condition) IsStringMatch() bool {
+	switch c.Op {
+	case OpRegex, OpRegexIgnoreCase, OpPrefix, OpPrefixIgnoreCase, OpContains, OpContainsIgnoreCase:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pattern returns the regular expression that a condition with a string matching operator
+// matches values against. Prefix and contains values are quoted to match literally and
+// regex values must be valid RE2 expressions, which rules out constructs with exponential
+// matching time. The result is valid both in RE2 and PCRE.
+func (c Condition) Pattern() (string, error) {
+	var pattern string
+	switch c.Op {
+	case OpRegex, OpRegexIgnoreCase:
+		if _, err := regexp.Compile(c.Value); err != nil {
+			return "", err
+		}
+		pattern = c.Value
+	case OpPrefix, OpPrefixIgnoreCase:
+		pattern = "^" + regexp.QuoteMeta(c.Value)
+	case OpContains, OpContainsIgnoreCase:
+		pattern = regexp.QuoteMeta(c.Value)
+	default:
+		return "", fmt.Errorf("%q is not a string matching operator", c.Op)
+	}
+	switch c.Op {
+	case OpRegexIgnoreCase, OpPrefixIgnoreCase, OpContainsIgnoreCase:
+		pattern = "(?i)" + pattern
+	}
+	return pattern, nil
+}
+
+// CastValue casts a value of a condition to the type of its TypeConv, e.g. "int".
+// Event times are stored as epoch milliseconds, so times are cast to them.
+func CastValue(typeConv string, value string) (interface{}, error) {
+	switch typeConv {
+	case "int":
+		return strconv.ParseInt(value, 0, 64)
+	case "double":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	case "time":
+		t, err := ParseTime(value, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return t.UnixMilli(), nil
+	default:
+		return value, nil
+	}
+}
+
+// validate checks that a string matching operator is used on a string with a valid pattern
+// and that the values of time conditions are valid times.
+func (c Condition) validate() error {
+	if c.TypeConv == "time" {
+		values := c.Values
+		if values == nil {
+			values = []string{c.Value}
+		}
+		for _, value := range values {
+			if _, err := ParseTime(value, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
+	if !c.IsStringMatch() {
+		return nil
+	}
+	if c.TypeConv != "" {
+		return fmt.Errorf("%q can only be used on strings, not on %s(%s)", c.Op, c.TypeConv, c.Field)
+	}
+	_, err := c.Pattern()
+	return err
+}
+
+// String formats the condition in the query syntax, so that Parse returns it again.
+func (c Condition) String() string {
+	switch {
+	case c.IsGroup():
+		separator := "&"
+		if c.Op == OpOr {
+			separator = "|"
+		}
+		return "(" + Format(c.Conditions, separator) + ")"
+	case c.Op == "exists" && c.Value == "false":
+		return "!" + c.Field
+	case c.Op == "exists":
+		return c.Field
+	}
+	field := c.Field
+	if c.TypeConv != "" {
+		field = c.TypeConv + "(" + c.Field + ")"
+	}
+	switch c.Op {
+	case OpIn, OpNotIn:
+		values := make([]string, 0, len(c.Values))
+		for _, value := range c.Values {
+			values = append(values, url.QueryEscape(value))
+		}
+		op := "=in"
+		if c.Op == OpNotIn {
+			op = "!=in"
+		}
+		return field + op + "(" + strings.Join(values, ",") + ")"
+	default:
+		return field + opEscaper.Replace(c.Op) + url.QueryEscape(c.Value)
+	}
+}
+
+// opEscaper escapes the characters of operators that the query syntax requires to be escaped.
+var opEscaper = strings.NewReplacer("<", "%3C", ">", "%3E", "^", "%5E")
+
+// Format formats conditions in the query syntax, separated by separator, which is "&"
+// if all conditions must match and "|" if any condition must match.
+func Format(conditions []Condition, separator string) string {
+	formatted := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		formatted = append(formatted, condition.String())
+	}
+	return strings.Join(formatted, separator)
+}
+
+// asCondition turns a list of conditions that all must match into a single condition.
+func asCondition(conditions []Condition) Condition {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return Condition{Op: OpAnd, Conditions: conditions}
 }
 
 // toIfaceSlice converts an interface to a slice of interfaces.
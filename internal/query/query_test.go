@@ -0,0 +1,238 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that queries are parsed into the expected conditions.
+func TestParse(t *testing.T) {
+	activityStarted := Condition{Field: "meta.type", Op: "=", Value: "EiffelActivityStartedEvent"}
+	activityFinished := Condition{Field: "meta.type", Op: "=", Value: "EiffelActivityFinishedEvent"}
+	domain := Condition{Field: "meta.source.domainId", Op: "=", Value: "my.domain"}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []Condition
+	}{
+		{
+			name:     "Single",
+			query:    "meta.type=EiffelActivityStartedEvent",
+			expected: []Condition{activityStarted},
+		},
+		{
+			name:  "And",
+			query: "meta.type=EiffelActivityStartedEvent&int(meta.time)%3E=1000&!data.customData",
+			expected: []Condition{
+				activityStarted,
+				{Field: "meta.time", Op: ">=", Value: "1000", TypeConv: "int"},
+				{Field: "data.customData", Op: "exists", Value: "false", TypeConv: "bool"},
+			},
+		},
+		{
+			name:  "Or",
+			query: "meta.type=EiffelActivityStartedEvent|meta.type=EiffelActivityFinishedEvent",
+			expected: []Condition{
+				{Op: OpOr, Conditions: []Condition{activityStarted, activityFinished}},
+			},
+		},
+		{
+			name:  "AndBindsTighterThanOr",
+			query: "meta.type=EiffelActivityStartedEvent&meta.source.domainId=my.domain|meta.type=EiffelActivityFinishedEvent",
+			expected: []Condition{
+				{Op: OpOr, Conditions: []Condition{
+					{Op: OpAnd, Conditions: []Condition{activityStarted, domain}},
+					activityFinished,
+				}},
+			},
+		},
+		{
+			name:  "Parentheses",
+			query: "meta.source.domainId=my.domain&(meta.type=EiffelActivityStartedEvent|meta.type=EiffelActivityFinishedEvent)",
+			expected: []Condition{
+				domain,
+				{Op: OpOr, Conditions: []Condition{activityStarted, activityFinished}},
+			},
+		},
+		{
+			name:     "RedundantParentheses",
+			query:    "((meta.type=EiffelActivityStartedEvent)&meta.source.domainId=my.domain)",
+			expected: []Condition{activityStarted, domain},
+		},
+		{
+			name:  "StringMatching",
+			query: "data.identity~=my.namespace/.*@1.0.0&data.name~*=^b&data.identity^=pkg:&data.heading%5E*=fix&data.name*=art&data.name**=ART",
+			expected: []Condition{
+				{Field: "data.identity", Op: OpRegex, Value: "my.namespace/.*@1.0.0"},
+				{Field: "data.name", Op: OpRegexIgnoreCase, Value: "^b"},
+				{Field: "data.identity", Op: OpPrefix, Value: "pkg:"},
+				{Field: "data.heading", Op: OpPrefixIgnoreCase, Value: "fix"},
+				{Field: "data.name", Op: OpContains, Value: "art"},
+				{Field: "data.name", Op: OpContainsIgnoreCase, Value: "ART"},
+			},
+		},
+		{
+			name:  "SetMembership",
+			query: "meta.type=in(EiffelActivityStartedEvent,EiffelActivityFinishedEvent)&int(meta.version)!=in(1,2)&data.name=in(a%2Cb)",
+			expected: []Condition{
+				{Field: "meta.type", Op: OpIn, Values: []string{"EiffelActivityStartedEvent", "EiffelActivityFinishedEvent"}},
+				{Field: "meta.version", Op: OpNotIn, Values: []string{"1", "2"}, TypeConv: "int"},
+				{Field: "data.name", Op: OpIn, Values: []string{"a,b"}},
+			},
+		},
+		{
+			name:  "Time",
+			query: "time(meta.time)%3E=now-24h&time(meta.time)%3C2021-06-01T12:00:00Z",
+			expected: []Condition{
+				{Field: "meta.time", Op: ">=", Value: "now-24h", TypeConv: "time"},
+				{Field: "meta.time", Op: "<", Value: "2021-06-01T12:00:00Z", TypeConv: "time"},
+			},
+		},
+		{
+			name:  "InAsPlainValue",
+			query: "data.name=index&data.value=in%28x%29",
+			expected: []Condition{
+				{Field: "data.name", Op: "=", Value: "index"},
+				{Field: "data.value", Op: "=", Value: "in(x)"},
+			},
+		},
+		{
+			name:  "EscapedOperatorsInValue",
+			query: "data.name=a%7Cb%28c%29",
+			expected: []Condition{
+				{Field: "data.name", Op: "=", Value: "a|b(c)"},
+			},
+		},
+		{
+			name:  "QuotedValues",
+			query: `data.name="a|b)"|data.value!=in("x,y","(z)",w)&data.heading="%22q%22"`,
+			expected: []Condition{
+				{Op: OpOr, Conditions: []Condition{
+					{Field: "data.name", Op: "=", Value: "a|b)"},
+					{Op: OpAnd, Conditions: []Condition{
+						{Field: "data.value", Op: OpNotIn, Values: []string{"x,y", "(z)", "w"}},
+						{Field: "data.heading", Op: "=", Value: `"q"`},
+					}},
+				}},
+			},
+		},
+		{
+			name:  "QuotesWithinValue",
+			query: `data.name="a"b&data.value=a"b"&data.heading=""`,
+			expected: []Condition{
+				{Field: "data.name", Op: "=", Value: `"a"b`},
+				{Field: "data.value", Op: "=", Value: `a"b"`},
+				{Field: "data.heading", Op: "=", Value: ""},
+			},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			res, err := Parse("nofile", []byte(testCase.query))
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, res)
+		})
+	}
+}
+
+// Test that malformed queries are rejected.
+func TestParseErrors(t *testing.T) {
+	for _, query := range []string{
+		"(meta.type=a", "meta.type=a)", "meta.type=a|", "|meta.type=a", "()",
+		"data.name~=(", "int(meta.time)^=1", "meta.type=in(a)b",
+		`data.name="a)b"c)`,
+		"time(meta.time)%3E=yesterday", "time(meta.time)=in(now,1.5)", "time(meta.time)~=now",
+	} {
+		_, err := Parse("nofile", []byte(query))
+		assert.Errorf(t, err, "query: %s", query)
+	}
+}
+
+// Test that string matching conditions are turned into regular expressions.
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		op       string
+		value    string
+		expected string
+	}{
+		{op: OpRegex, value: "a.*b", expected: "a.*b"},
+		{op: OpRegexIgnoreCase, value: "a.*b", expected: "(?i)a.*b"},
+		{op: OpPrefix, value: "pkg:maven/a.b", expected: `^pkg:maven/a\.b`},
+		{op: OpPrefixIgnoreCase, value: "a+", expected: `(?i)^a\+`},
+		{op: OpContains, value: "(x)", expected: `\(x\)`},
+		{op: OpContainsIgnoreCase, value: "x", expected: "(?i)x"},
+	}
+	for _, testCase := range tests {
+		pattern, err := Condition{Field: "data.name", Op: testCase.op, Value: testCase.value}.Pattern()
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, pattern)
+	}
+
+	_, err := Condition{Field: "data.name", Op: "=", Value: "x"}.Pattern()
+	assert.Error(t, err)
+	_, err = Condition{Field: "data.name", Op: OpRegex, Value: "(?=lookahead)"}.Pattern()
+	assert.Error(t, err)
+}
+
+// Test that values are cast to the type of the condition, and times to epoch milliseconds.
+func TestCastValue(t *testing.T) {
+	tests := []struct {
+		typeConv string
+		value    string
+		expected interface{}
+	}{
+		{typeConv: "", value: "1000", expected: "1000"},
+		{typeConv: "int", value: "1000", expected: int64(1000)},
+		{typeConv: "int", value: "0x10", expected: int64(16)},
+		{typeConv: "double", value: "1.5", expected: 1.5},
+		{typeConv: "bool", value: "true", expected: true},
+		{typeConv: "time", value: "2021-06-01T12:00:00Z", expected: int64(1622548800000)},
+	}
+	for _, testCase := range tests {
+		value, err := CastValue(testCase.typeConv, testCase.value)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, value)
+	}
+
+	for _, typeConv := range []string{"int", "double", "bool", "time"} {
+		_, err := CastValue(typeConv, "nah")
+		assert.Errorf(t, err, "type: %s", typeConv)
+	}
+}
+
+// Test that formatted conditions are parsed into the same conditions.
+func TestFormat(t *testing.T) {
+	for _, query := range []string{
+		"meta.type=EiffelActivityStartedEvent&int(meta.time)%3E=1000&!data.customData&data.name",
+		"meta.type=a|(meta.type=b&data.name%3C=c)|data.name=in(x,y%2Cz)",
+		"data.name!=a%26b&data.value=%28%7C%29&data.identity^*=Pkg&data.x~=a.*b&double(data.y)!=in(1.5,2)",
+		"data.name=a+b&time(meta.time)%3Enow-24h&bool(data.z)=true&data.w**=x",
+		`data.name="a|b)"&data.value=in("x,y",%22z%22)&data.heading=%22q`,
+	} {
+		conditions, err := Parse("nofile", []byte(query))
+		require.NoError(t, err)
+		formatted := Format(conditions.([]Condition), "&")
+		reparsed, err := Parse("nofile", []byte(formatted))
+		require.NoErrorf(t, err, "formatted: %s", formatted)
+		assert.Equalf(t, conditions, reparsed, "formatted: %s", formatted)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the ISO-8601 layouts accepted by ParseTime. Times without
+// a time zone are in UTC.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// durationUnits are the units of relative times. Days and weeks are not
+// supported by time.ParseDuration but are useful when looking back in time.
+var durationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+}
+
+var (
+	relativeTime = regexp.MustCompile(`^now(?:([+-])((?:\d+(?:ms|s|m|h|d|w))+))?$`)
+	durationPart = regexp.MustCompile(`(\d+)(ms|s|m|h|d|w)`)
+)
+
+// ParseTime parses the value of a time(...) condition. The value is either an
+// ISO-8601 time, such as "2021-06-01T12:00:00Z" or "2021-06-01", epoch milliseconds
+// or a time relative to now, such as "now", "now-24h" or "now-1d12h".
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	// An unencoded '+' in a query string is decoded as a space.
+	value = strings.ReplaceAll(value, " ", "+")
+	if match := relativeTime.FindStringSubmatch(value); match != nil {
+		var offset time.Duration
+		for _, part := range durationPart.FindAllStringSubmatch(match[2], -1) {
+			n, err := strconv.ParseInt(part[1], 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid relative time %q: %w", value, err)
+			}
+			offset += time.Duration(n) * durationUnits[part[2]]
+		}
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return now.Add(offset), nil
+	}
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(millis), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected ISO-8601, epoch milliseconds or e.g. now-24h", value)
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that ISO-8601, epoch milliseconds and relative times are parsed.
+func TestParseTime(t *testing.T) {
+	now := time.Date(2021, 6, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Time
+	}{
+		{value: "2021-06-01T12:00:00Z", expected: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{value: "2021-06-01T12:00:00.250+02:00", expected: time.Date(2021, 6, 1, 10, 0, 0, 250e6, time.UTC)},
+		{value: "2021-06-01T12:00:00 02:00", expected: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)},
+		{value: "2021-06-01T12:00", expected: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{value: "2021-06-01", expected: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "1622548800000", expected: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{value: "now", expected: now},
+		{value: "now-24h", expected: now.Add(-24 * time.Hour)},
+		{value: "now-1d12h", expected: now.Add(-36 * time.Hour)},
+		{value: "now-2w", expected: now.AddDate(0, 0, -14)},
+		{value: "now+30m", expected: now.Add(30 * time.Minute)},
+		{value: "now 500ms", expected: now.Add(500 * time.Millisecond)},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.value, func(t *testing.T) {
+			parsed, err := ParseTime(testCase.value, now)
+			require.NoError(t, err)
+			assert.True(t, testCase.expected.Equal(parsed), "expected %v, got %v", testCase.expected, parsed)
+		})
+	}
+
+	for _, value := range []string{"", "yesterday", "now-", "now-24", "now-1y", "2021-13-01", "1.5"} {
+		_, err := ParseTime(value, now)
+		assert.Errorf(t, err, "value: %q", value)
+	}
+}
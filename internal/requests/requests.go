@@ -18,18 +18,263 @@
 // database and handlers.
 package requests
 
-import "github.com/eiffel-community/eiffel-goer/internal/query"
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+)
 
 type MultipleEventsRequest struct {
-	Shallow       bool  `schema:"shallow"` // TODO: Unused
-	PageNo        int   `schema:"pageNo"`
-	PageSize      int   `schema:"pageSize"`
-	PageStartItem int32 `schema:"pageStartItem"`
-	Lazy          bool  `schema:"lazy"`
-	Readable      bool  `schema:"readable"` // TODO: Unused
+	Shallow       bool   `schema:"shallow"`
+	PageNo        int    `schema:"pageNo"`
+	PageSize      int    `schema:"pageSize"`
+	PageStartItem int32  `schema:"pageStartItem"`
+	Lazy          bool   `schema:"lazy"`
+	Readable      bool   `schema:"readable"`
+	Sort          Sort   `schema:"sort"`
+	Cursor        Cursor `schema:"cursor"`
+	Fields        Fields `schema:"fields"`
 	Conditions    []query.Condition
 }
 
+// Skip returns the number of events before the requested page. PageStartItem counts
+// from 1 and skips events in addition to the pages before PageNo.
+func (r MultipleEventsRequest) Skip() int {
+	return (r.PageNo-1)*r.PageSize + max(int(r.PageStartItem)-1, 0)
+}
+
+// SortKey is a field that events are ordered by.
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+// Sort is the order of events. It is given as a comma-separated list of fields,
+// where fields prefixed with '-' are in descending order, e.g. "-meta.time,meta.type".
+type Sort []SortKey
+
+// fieldName matches the same fields as the field of a query condition.
+var fieldName = regexp.MustCompile(`^[a-zA-Z0-9]+(\.[a-zA-Z0-9]+)*$`)
+
+// UnmarshalText parses a sort parameter.
+func (s *Sort) UnmarshalText(text []byte) error {
+	*s = nil
+	if len(text) == 0 {
+		return nil
+	}
+	for _, field := range strings.Split(string(text), ",") {
+		key := SortKey{Field: field}
+		if strings.HasPrefix(field, "-") {
+			key = SortKey{Field: field[1:], Descending: true}
+		}
+		if !fieldName.MatchString(key.Field) {
+			return fmt.Errorf("invalid sort field %q", field)
+		}
+		*s = append(*s, key)
+	}
+	return nil
+}
+
+// String formats the sort order like the sort parameter.
+func (s Sort) String() string {
+	fields := make([]string, 0, len(s))
+	for _, key := range s {
+		if key.Descending {
+			fields = append(fields, "-"+key.Field)
+		} else {
+			fields = append(fields, key.Field)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// Fields are the fields of events to include in a response, given as a comma-separated
+// list, e.g. "meta.id,meta.type,data.identity". Drivers may include more fields than
+// requested, so handlers remove the others with drivers.EiffelEvent.Project.
+type Fields []string
+
+// UnmarshalText parses a fields parameter.
+func (f *Fields) UnmarshalText(text []byte) error {
+	*f = nil
+	if len(text) == 0 {
+		return nil
+	}
+	for _, field := range strings.Split(string(text), ",") {
+		if !fieldName.MatchString(field) {
+			return fmt.Errorf("invalid field %q", field)
+		}
+		*f = append(*f, field)
+	}
+	return nil
+}
+
+// Normalized returns the fields sorted, without duplicates and without fields that are
+// within another of the fields, e.g. "meta.id" is removed if there is also "meta".
+func (f Fields) Normalized() Fields {
+	sorted := slices.Clone(f)
+	slices.Sort(sorted)
+	normalized := make(Fields, 0, len(sorted))
+	for _, field := range sorted {
+		covered := false
+		for _, kept := range normalized {
+			if field == kept || strings.HasPrefix(field, kept+".") {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			normalized = append(normalized, field)
+		}
+	}
+	return normalized
+}
+
+// Cursor is a position in an ordered list of events, which is right after an event
+// with the values After for the keys of the order. The order is Sort with meta.id
+// as the last key, see drivers.OrderBy.
+type Cursor struct {
+	Sort  Sort
+	After []interface{}
+}
+
+type cursorJSON struct {
+	Sort  string        `json:"s"`
+	After []interface{} `json:"a"`
+}
+
+// IsZero tests whether the cursor is unset, i.e. at the start of the events.
+func (c Cursor) IsZero() bool {
+	return c.After == nil
+}
+
+// MarshalText encodes the cursor as an opaque, URL-safe token.
+func (c Cursor) MarshalText() ([]byte, error) {
+	content, err := json.Marshal(cursorJSON{Sort: c.Sort.String(), After: c.After})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.RawURLEncoding.EncodeToString(content)), nil
+}
+
+// UnmarshalText decodes a cursor token created by MarshalText.
+func (c *Cursor) UnmarshalText(text []byte) error {
+	content, err := base64.RawURLEncoding.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid cursor: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var decoded cursorJSON
+	if err := decoder.Decode(&decoded); err != nil {
+		return fmt.Errorf("invalid cursor: %w", err)
+	}
+	if decoded.After == nil {
+		return fmt.Errorf("invalid cursor: no position")
+	}
+	var sort Sort
+	if err := sort.UnmarshalText([]byte(decoded.Sort)); err != nil {
+		return fmt.Errorf("invalid cursor: %w", err)
+	}
+	after := make([]interface{}, 0, len(decoded.After))
+	for _, value := range decoded.After {
+		switch v := value.(type) {
+		case json.Number:
+			// Keep integers, such as epoch milliseconds, exact.
+			if i, err := v.Int64(); err == nil {
+				after = append(after, i)
+			} else if f, err := v.Float64(); err == nil {
+				after = append(after, f)
+			} else {
+				return fmt.Errorf("invalid cursor: %w", err)
+			}
+		case string, bool, nil:
+			after = append(after, v)
+		default:
+			return fmt.Errorf("invalid cursor: unsupported value %v", v)
+		}
+	}
+	*c = Cursor{Sort: sort, After: after}
+	return nil
+}
+
 type SingleEventRequest struct {
-	Shallow bool `schema:"shallow"` // TODO: Unused
+	Shallow  bool   `schema:"shallow"`
+	Readable bool   `schema:"readable"`
+	Fields   Fields `schema:"fields"`
+}
+
+// LinkTypeAll is the link type that makes a search follow links of any type.
+const LinkTypeAll = "ALL"
+
+// SearchParameters are the link types that an upstream/downstream search follows.
+type SearchParameters struct {
+	DLT []string `json:"dlt" schema:"dlt"`
+	ULT []string `json:"ult" schema:"ult"`
+}
+
+type SearchRequest struct {
+	Limit    int  `schema:"limit"`
+	Levels   int  `schema:"levels"`
+	Tree     bool `schema:"tree"`
+	Shallow  bool `schema:"shallow"`
+	Readable bool `schema:"readable"`
+	SearchParameters
+	Conditions []query.Condition
+}
+
+type PathRequest struct {
+	From      string   `schema:"from,required"`
+	To        string   `schema:"to,required"`
+	LinkTypes []string `schema:"linkTypes"`
+	Levels    int      `schema:"levels"`
+}
+
+// SchemaTags returns the schema tags of all fields, including the fields of embedded
+// structs, in a pointer to a request struct.
+func SchemaTags(request interface{}) map[string]struct{} {
+	tags := make(map[string]struct{})
+	addSchemaTags(reflect.TypeOf(request).Elem(), tags)
+	return tags
+}
+
+func addSchemaTags(t reflect.Type, tags map[string]struct{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addSchemaTags(field.Type, tags)
+			continue
+		}
+		tag := field.Tag.Get("schema")
+		tags[tag] = struct{}{}
+	}
+}
+
+// BuildConditions takes a raw URL query, parses out all conditions and removes ignoreKeys.
+func BuildConditions(rawQuery string, ignoreKeys map[string]struct{}) ([]query.Condition, error) {
+	if rawQuery == "" {
+		return nil, nil
+	}
+	res, err := query.Parse("nofile", []byte(rawQuery))
+	if err != nil {
+		return nil, err
+	}
+	allConditions, ok := res.([]query.Condition)
+	if !ok {
+		return nil, fmt.Errorf("query parser unexpectedly returned a %T value from the query %q", res, rawQuery)
+	}
+	var conditions []query.Condition
+	for _, condition := range allConditions {
+		_, ok := ignoreKeys[condition.Field]
+		if !ok {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions, nil
 }
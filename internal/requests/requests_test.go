@@ -0,0 +1,79 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package requests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that sort parameters are parsed and formatted.
+func TestSort(t *testing.T) {
+	var sort Sort
+	require.NoError(t, sort.UnmarshalText([]byte("-meta.time,meta.type")))
+	assert.Equal(t, Sort{{Field: "meta.time", Descending: true}, {Field: "meta.type"}}, sort)
+	assert.Equal(t, "-meta.time,meta.type", sort.String())
+
+	require.NoError(t, sort.UnmarshalText(nil))
+	assert.Nil(t, sort)
+
+	for _, bad := range []string{",", "-", "--meta.time", "meta.time,", "meta..time", "meta.$where"} {
+		assert.Errorf(t, sort.UnmarshalText([]byte(bad)), "sort: %q", bad)
+	}
+}
+
+// Test that cursors survive being encoded as tokens.
+func TestCursor(t *testing.T) {
+	cursor := Cursor{
+		Sort:  Sort{{Field: "meta.time", Descending: true}, {Field: "data.name"}, {Field: "data.done"}},
+		After: []interface{}{int64(1629449650361), nil, true, 0.5, "a-b"},
+	}
+	token, err := cursor.MarshalText()
+	require.NoError(t, err)
+	assert.Regexp(t, `^[A-Za-z0-9_-]+$`, string(token))
+
+	var decoded Cursor
+	require.NoError(t, decoded.UnmarshalText(token))
+	assert.Equal(t, cursor, decoded)
+	assert.False(t, decoded.IsZero())
+	assert.True(t, Cursor{}.IsZero())
+
+	for _, bad := range []string{"", "!", "e30", "eyJhIjpbe31dfQ"} {
+		assert.Errorf(t, decoded.UnmarshalText([]byte(bad)), "cursor: %q", bad)
+	}
+}
+
+// Test that the events before a page are skipped.
+func TestSkip(t *testing.T) {
+	assert.Equal(t, 0, MultipleEventsRequest{PageNo: 1, PageSize: 500, PageStartItem: 1}.Skip())
+	assert.Equal(t, 1000, MultipleEventsRequest{PageNo: 3, PageSize: 500, PageStartItem: 1}.Skip())
+	assert.Equal(t, 9, MultipleEventsRequest{PageNo: 1, PageSize: 500, PageStartItem: 10}.Skip())
+	assert.Equal(t, 0, MultipleEventsRequest{PageNo: 1, PageSize: 500}.Skip())
+}
+
+// Test that fields parameters are parsed and normalized.
+func TestFields(t *testing.T) {
+	var fields Fields
+	require.NoError(t, fields.UnmarshalText([]byte("meta.id,data,meta.type,data.identity,meta.id,metadata")))
+	assert.Equal(t, Fields{"meta.id", "data", "meta.type", "data.identity", "meta.id", "metadata"}, fields)
+	assert.Equal(t, Fields{"data", "meta.id", "meta.type", "metadata"}, fields.Normalized())
+
+	for _, bad := range []string{",", "meta.id,", "meta.$where", "meta id"} {
+		assert.Errorf(t, fields.UnmarshalText([]byte(bad)), "fields: %q", bad)
+	}
+}
@@ -29,6 +29,13 @@ func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	_, _ = w.Write(response)
 }
 
+// RespondWithContent writes a response with a content type and a status code to the HTTP ResponseWriter.
+func RespondWithContent(w http.ResponseWriter, code int, contentType string, content []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	_, _ = w.Write(content)
+}
+
 // RespondWithError writes a response with an error message and status code to the HTTP ResponseWriter.
 func RespondWithError(w http.ResponseWriter, code int, message string) {
 	w.WriteHeader(code)
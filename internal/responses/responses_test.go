@@ -31,6 +31,15 @@ func TestRespondWithJSON(t *testing.T) {
 	assert.JSONEq(t, `{"hello": "world"}`, responseRecorder.Body.String())
 }
 
+// Test that RespondWithContent writes the correct HTTP code, content and content type header.
+func TestRespondWithContent(t *testing.T) {
+	responseRecorder := httptest.NewRecorder()
+	RespondWithContent(responseRecorder, 200, "text/vnd.graphviz", []byte("digraph {}"))
+	assert.Equal(t, "text/vnd.graphviz", responseRecorder.Header().Get("Content-Type"))
+	assert.Equal(t, 200, responseRecorder.Result().StatusCode) //nolint:bodyclose
+	assert.Equal(t, "digraph {}", responseRecorder.Body.String())
+}
+
 // Test that RespondWithError writes the correct HTTP code, message and adds a content type header.
 func TestRespondWithError(t *testing.T) {
 	responseRecorder := httptest.NewRecorder()
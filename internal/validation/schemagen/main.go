@@ -0,0 +1,292 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Schemagen writes JSON schemas of the Eiffel events from the event types of the
+// Eiffel events SDK for Go, which are generated from the schemas of the Eiffel protocol,
+// for when the protocol repository can't be reached by scripts/update-schemas.sh:
+//
+//	go run ./internal/validation/schemagen internal/validation/schemas
+//
+// The schemas have the types, required properties and enums of the protocol schemas,
+// but not e.g. their patterns, and there is one schema for the latest version of each
+// major version of an event type that the SDK knows.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const sdkPackage = "github.com/eiffel-community/eiffelevents-sdk-go"
+
+// schema is a JSON schema.
+type schema map[string]interface{}
+
+// sdk is the parsed source of the SDK package.
+type sdk struct {
+	// types are the type declarations of the package, by name.
+	types map[string]ast.Expr
+	// enums are the values of the string constants of the types that have any.
+	enums map[string][]string
+}
+
+// event is an event type and version and the name of the Go type of the event.
+type event struct {
+	Type    string
+	Version string
+	GoType  string
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <schema directory>\n", os.Args[0])
+		os.Exit(2)
+	}
+	if err := run(os.Args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run writes the schemas of all events in the SDK to <directory>/<meta.type>/<meta.version>.json.
+func run(directory string) error {
+	pkg, err := build.Import(sdkPackage, ".", build.FindOnly)
+	if err != nil {
+		return err
+	}
+	source, events, err := parse(pkg.Dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		content, err := json.MarshalIndent(source.event(e), "", "  ")
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(directory, e.Type, e.Version+".json")
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, append(content, '\n'), 0o644); err != nil { //nolint:gosec
+			return err
+		}
+	}
+	fmt.Printf("Wrote %d schemas from %s\n", len(events), pkg.Dir)
+	return nil
+}
+
+// parse parses the SDK package in a directory and returns its source and its events.
+func parse(dir string) (*sdk, []event, error) {
+	packages, err := parser.ParseDir(token.NewFileSet(), dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkg, ok := packages["eiffelevents"]
+	if !ok {
+		return nil, nil, fmt.Errorf("no eiffelevents package in %s", dir)
+	}
+	source := &sdk{types: map[string]ast.Expr{}, enums: map[string][]string{}}
+	var events []event
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					source.types[spec.Name.Name] = spec.Type
+				case *ast.ValueSpec:
+					source.addEnum(spec)
+					if len(spec.Names) == 1 && spec.Names[0].Name == "eventTypeTable" && len(spec.Values) == 1 {
+						if events, err = eventTable(spec.Values[0]); err != nil {
+							return nil, nil, err
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(events) == 0 {
+		return nil, nil, fmt.Errorf("no event type table in %s", dir)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Type+"/"+events[i].Version < events[j].Type+"/"+events[j].Version
+	})
+	return source, events, nil
+}
+
+// addEnum adds the value of a string constant of a type to the enums of the type.
+func (s *sdk) addEnum(spec *ast.ValueSpec) {
+	typeName, ok := spec.Type.(*ast.Ident)
+	if !ok || len(spec.Values) != 1 {
+		return
+	}
+	literal, ok := spec.Values[0].(*ast.BasicLit)
+	if !ok || literal.Kind != token.STRING {
+		return
+	}
+	if value, err := strconv.Unquote(literal.Value); err == nil {
+		s.enums[typeName.Name] = append(s.enums[typeName.Name], value)
+	}
+}
+
+// eventTable returns the events of the event type table of the SDK, which maps event
+// types to their major versions and those to the Go type and latest version, e.g.
+//
+//	"EiffelActivityTriggeredEvent": {
+//		4: majorEventVersion{reflect.TypeOf(ActivityTriggeredV4{}), "4.1.0"},
+//	},
+func eventTable(table ast.Expr) ([]event, error) {
+	var events []event
+	literal, ok := table.(*ast.CompositeLit)
+	if !ok {
+		return nil, fmt.Errorf("unexpected event type table %T", table)
+	}
+	for _, element := range literal.Elts {
+		typeElement, ok := element.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, fmt.Errorf("unexpected event type table element %T", element)
+		}
+		eventType, err := stringLiteral(typeElement.Key)
+		if err != nil {
+			return nil, err
+		}
+		majors, ok := typeElement.Value.(*ast.CompositeLit)
+		if !ok {
+			return nil, fmt.Errorf("unexpected versions of %s", eventType)
+		}
+		for _, element := range majors.Elts {
+			majorElement, ok := element.(*ast.KeyValueExpr)
+			if !ok {
+				return nil, fmt.Errorf("unexpected versions of %s", eventType)
+			}
+			major, ok := majorElement.Value.(*ast.CompositeLit)
+			if !ok || len(major.Elts) != 2 {
+				return nil, fmt.Errorf("unexpected version of %s", eventType)
+			}
+			version, err := stringLiteral(major.Elts[1])
+			if err != nil {
+				return nil, err
+			}
+			// reflect.TypeOf(ActivityTriggeredV4{})
+			call, ok := major.Elts[0].(*ast.CallExpr)
+			if !ok || len(call.Args) != 1 {
+				return nil, fmt.Errorf("unexpected Go type of %s %s", eventType, version)
+			}
+			value, ok := call.Args[0].(*ast.CompositeLit)
+			if !ok {
+				return nil, fmt.Errorf("unexpected Go type of %s %s", eventType, version)
+			}
+			goType, ok := value.Type.(*ast.Ident)
+			if !ok {
+				return nil, fmt.Errorf("unexpected Go type of %s %s", eventType, version)
+			}
+			events = append(events, event{Type: eventType, Version: version, GoType: goType.Name})
+		}
+	}
+	return events, nil
+}
+
+// stringLiteral returns the value of a string literal.
+func stringLiteral(expr ast.Expr) (string, error) {
+	literal, ok := expr.(*ast.BasicLit)
+	if !ok || literal.Kind != token.STRING {
+		return "", fmt.Errorf("unexpected %T where a string was expected", expr)
+	}
+	return strconv.Unquote(literal.Value)
+}
+
+// event returns the schema of an event, where meta.type and meta.version can only be
+// the type and version of the event.
+func (s *sdk) event(e event) schema {
+	result := s.schema(ast.NewIdent(e.GoType))
+	result["$schema"] = "http://json-schema.org/draft-04/schema#"
+	meta := result["properties"].(map[string]interface{})["meta"].(schema)
+	properties := meta["properties"].(map[string]interface{})
+	properties["type"].(schema)["enum"] = []string{e.Type}
+	properties["version"].(schema)["enum"] = []string{e.Version}
+	return result
+}
+
+// schema returns the schema of the JSON encoding of a Go type of the SDK.
+func (s *sdk) schema(expr ast.Expr) schema {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		switch expr.Name {
+		case "string":
+			return schema{"type": "string"}
+		case "bool":
+			return schema{"type": "boolean"}
+		case "int", "int32", "int64":
+			return schema{"type": "integer"}
+		case "float32", "float64":
+			return schema{"type": "number"}
+		}
+		if values, ok := s.enums[expr.Name]; ok {
+			return schema{"type": "string", "enum": values}
+		}
+		if underlying, ok := s.types[expr.Name]; ok {
+			return s.schema(underlying)
+		}
+	case *ast.StarExpr:
+		return s.schema(expr.X)
+	case *ast.ArrayType:
+		return schema{"type": "array", "items": s.schema(expr.Elt)}
+	case *ast.MapType:
+		return schema{"type": "object", "additionalProperties": s.schema(expr.Value)}
+	case *ast.StructType:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for _, field := range expr.Fields.List {
+			if field.Tag == nil {
+				continue
+			}
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				continue
+			}
+			name, options, _ := strings.Cut(reflect.StructTag(tag).Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			properties[name] = s.schema(field.Type)
+			if options != "omitempty" {
+				required = append(required, name)
+			}
+		}
+		result := schema{"type": "object", "properties": properties, "additionalProperties": false}
+		if len(required) > 0 {
+			result["required"] = required
+		}
+		return result
+	}
+	// Anything else, i.e. interface{}, can be any value.
+	return schema{}
+}
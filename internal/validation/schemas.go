@@ -0,0 +1,164 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package validation
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+)
+
+// embedded are the Eiffel event schemas, in schemas/<meta.type>/<meta.version>.json as
+// in the Eiffel protocol repository. They are updated with scripts/update-schemas.sh,
+// or written from the Eiffel events SDK with schemagen, see schemas/README.md.
+//
+//go:embed schemas
+var embedded embed.FS
+
+// DefaultSchemas are the Eiffel event schemas that are embedded in Goer.
+// The variable is exported to assist with testing of other packages.
+var DefaultSchemas = NewSchemas(mustSub(embedded, "schemas"))
+
+// ErrNoSchema is returned, possibly wrapped, when there is no schema for the type and
+// version of an event.
+var ErrNoSchema = errors.New("no schema")
+
+// SchemaError is returned when an event does not match the schema of its type and version.
+type SchemaError struct {
+	// Schema is the name of the schema, <meta.type>/<meta.version>.
+	Schema string
+	// Problems are the places where the event does not match the schema, e.g.
+	// "/data: missing properties: 'name'".
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Schema, strings.Join(e.Problems, "; "))
+}
+
+// Schemas validates events against the schemas of their type and version.
+// The schemas are compiled when they are first used.
+type Schemas struct {
+	fsys     fs.FS
+	mutex    sync.Mutex
+	compiled map[string]*jsonschema.Schema
+}
+
+// NewSchemas creates a Schemas with the schemas in <meta.type>/<meta.version>.json
+// in a file system.
+func NewSchemas(fsys fs.FS) *Schemas {
+	return &Schemas{fsys: fsys, compiled: make(map[string]*jsonschema.Schema)}
+}
+
+// mustSub returns the file system of a directory in an embedded file system.
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// Name returns the name of the schema of an event type and version, or "" if there is none.
+func (s *Schemas) Name(eventType string, version string) string {
+	name := eventType + "/" + version
+	// The names are also paths, so they must not reach outside of the schemas.
+	if !fs.ValidPath(name) || strings.Count(name, "/") != 1 {
+		return ""
+	}
+	if _, err := fs.Stat(s.fsys, name+".json"); err != nil {
+		return ""
+	}
+	return name
+}
+
+// schema returns the compiled schema with a name.
+func (s *Schemas) schema(name string) (*jsonschema.Schema, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if schema, ok := s.compiled[name]; ok {
+		return schema, nil
+	}
+	content, err := fs.ReadFile(s.fsys, name+".json")
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	// The Eiffel schemas are draft 4 schemas, but do not all say so.
+	compiler.Draft = jsonschema.Draft4
+	url := "file:///" + path.Clean(name) + ".json"
+	if err := compiler.AddResource(url, bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("schema %s: %w", name, err)
+	}
+	schema, err := compiler.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", name, err)
+	}
+	s.compiled[name] = schema
+	return schema, nil
+}
+
+// Validate validates an event against the schema of its meta.type and meta.version.
+// Returns a *SchemaError if the event does not match the schema and ErrNoSchema if
+// there is no schema for the event.
+func (s *Schemas) Validate(event drivers.EiffelEvent) error {
+	version, _ := event.Get("meta.version")
+	versionString, _ := version.(string)
+	name := s.Name(event.Type(), versionString)
+	if name == "" {
+		return fmt.Errorf("%w for %s %v", ErrNoSchema, event.Type(), version)
+	}
+	schema, err := s.schema(name)
+	if err != nil {
+		return err
+	}
+	decoded, err := decode(event)
+	if err != nil {
+		return err
+	}
+	err = schema.Validate(map[string]interface{}(decoded))
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		return &SchemaError{Schema: name, Problems: problems(validationErr)}
+	}
+	return err
+}
+
+// problems returns the messages of the innermost causes of a validation error, which
+// are the places where the event does not match the schema.
+func problems(err *jsonschema.ValidationError) []string {
+	if len(err.Causes) == 0 {
+		location := err.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []string{location + ": " + err.Message}
+	}
+	var result []string
+	for _, cause := range err.Causes {
+		result = append(result, problems(cause)...)
+	}
+	return result
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package validation
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	eiffelevents "github.com/eiffel-community/eiffelevents-sdk-go/editions/lyon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+)
+
+const triggeredEvent = `{
+	"meta": {"id": "aaaaaaaa-bbbb-4ccc-8ddd-eeeeeeeeeeee", "type": "EiffelActivityTriggeredEvent", "version": "3.0.0", "time": 1629449650361},
+	"data": {"name": "Build"},
+	"links": []
+}`
+
+// testSchemas returns the schemas in testdata, which are test schemas in the same
+// format as the Eiffel schemas.
+func testSchemas() *Schemas {
+	return NewSchemas(os.DirFS("testdata/schemas"))
+}
+
+// Test that schemas are found by event type and version.
+func TestSchemasName(t *testing.T) {
+	schemas := testSchemas()
+	assert.Equal(t, "EiffelActivityTriggeredEvent/3.0.0", schemas.Name("EiffelActivityTriggeredEvent", "3.0.0"))
+	assert.Equal(t, "", schemas.Name("EiffelActivityTriggeredEvent", "4.0.0"))
+	assert.Equal(t, "", schemas.Name("EiffelActivityTriggeredEvent", ""))
+	assert.Equal(t, "", schemas.Name("..", "EiffelActivityTriggeredEvent/3.0.0"))
+	assert.Equal(t, "", schemas.Name("EiffelActivityTriggeredEvent/3.0.0", ""))
+}
+
+// Test that events are validated against the schema of their type and version.
+func TestSchemasValidate(t *testing.T) {
+	schemas := testSchemas()
+	event, err := drivers.DecodeEvent([]byte(triggeredEvent))
+	require.NoError(t, err)
+	assert.NoError(t, schemas.Validate(event))
+
+	// Events from the databases can have other types than decoded JSON.
+	event["data"] = drivers.EiffelEvent{"name": "Build", "executionType": "MANUAL"}
+	event["meta"].(map[string]interface{})["tags"] = []string{"nightly"}
+	assert.NoError(t, schemas.Validate(event))
+
+	event["data"] = map[string]interface{}{"executionType": "SOMETIMES"}
+	event["meta"].(map[string]interface{})["time"] = "yesterday"
+	err = schemas.Validate(event)
+	var schemaErr *SchemaError
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, "EiffelActivityTriggeredEvent/3.0.0", schemaErr.Schema)
+	assert.ElementsMatch(t, []string{
+		"/meta/time: expected integer, but got string",
+		"/data: missing properties: 'name'",
+		`/data/executionType: value must be one of "MANUAL", "SEMI_AUTOMATED", "AUTOMATED", "OTHER"`,
+	}, schemaErr.Problems)
+	assert.Contains(t, err.Error(), "EiffelActivityTriggeredEvent/3.0.0: ")
+
+	event["meta"].(map[string]interface{})["version"] = "4.0.0"
+	assert.ErrorIs(t, schemas.Validate(event), ErrNoSchema)
+
+	broken := drivers.EiffelEvent{"meta": map[string]interface{}{"type": "EiffelBrokenEvent", "version": "1.0.0"}}
+	err = schemas.Validate(broken)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNoSchema)
+	assert.NotErrorAs(t, err, &schemaErr)
+}
+
+// Test that events are validated against their schema, if there is one, on top of
+// the fields that all events have.
+func TestValidateSchemas(t *testing.T) {
+	defaultSchemas := DefaultSchemas
+	defer func() { DefaultSchemas = defaultSchemas }()
+	DefaultSchemas = testSchemas()
+
+	event, err := drivers.DecodeEvent([]byte(triggeredEvent))
+	require.NoError(t, err)
+	assert.NoError(t, Validate(event))
+
+	event["data"] = map[string]interface{}{}
+	var schemaErr *SchemaError
+	assert.ErrorAs(t, Validate(event), &schemaErr)
+
+	// There is no schema for the event, which still has the fields of all events.
+	event["meta"].(map[string]interface{})["version"] = "4.0.0"
+	assert.NoError(t, Validate(event))
+}
+
+// must returns an event that was created by the SDK, or panics if it could not be created.
+func must[T any](event T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return event
+}
+
+// Test that there is a schema in DefaultSchemas for every event type of the latest
+// edition of the Eiffel protocol, and that all the schemas compile.
+func TestDefaultSchemas(t *testing.T) {
+	events := []interface{}{
+		must(eiffelevents.NewActivityCanceled()),
+		must(eiffelevents.NewActivityFinished()),
+		must(eiffelevents.NewActivityStarted()),
+		must(eiffelevents.NewActivityTriggered()),
+		must(eiffelevents.NewAnnouncementPublished()),
+		must(eiffelevents.NewArtifactCreated()),
+		must(eiffelevents.NewArtifactPublished()),
+		must(eiffelevents.NewArtifactReused()),
+		must(eiffelevents.NewCompositionDefined()),
+		must(eiffelevents.NewConfidenceLevelModified()),
+		must(eiffelevents.NewEnvironmentDefined()),
+		must(eiffelevents.NewFlowContextDefined()),
+		must(eiffelevents.NewIssueDefined()),
+		must(eiffelevents.NewIssueVerified()),
+		must(eiffelevents.NewSourceChangeCreated()),
+		must(eiffelevents.NewSourceChangeSubmitted()),
+		must(eiffelevents.NewTestCaseCanceled()),
+		must(eiffelevents.NewTestCaseFinished()),
+		must(eiffelevents.NewTestCaseStarted()),
+		must(eiffelevents.NewTestCaseTriggered()),
+		must(eiffelevents.NewTestExecutionRecipeCollectionCreated()),
+		must(eiffelevents.NewTestSuiteFinished()),
+		must(eiffelevents.NewTestSuiteStarted()),
+	}
+	for _, sdkEvent := range events {
+		content, err := json.Marshal(sdkEvent)
+		require.NoError(t, err)
+		event, err := drivers.DecodeEvent(content)
+		require.NoError(t, err)
+		version, _ := event.Get("meta.version")
+		assert.NotEmpty(t, DefaultSchemas.Name(event.Type(), version.(string)), "no schema for %s %s", event.Type(), version)
+	}
+
+	names := 0
+	err := fs.WalkDir(DefaultSchemas.fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			return err
+		}
+		names++
+		_, err = DefaultSchemas.schema(strings.TrimSuffix(name, ".json"))
+		assert.NoError(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, names, len(events))
+
+	triggered := must(eiffelevents.NewActivityTriggered())
+	triggered.Data.Name = "Build"
+	triggered.Links.AddByID("CAUSE", "aaaaaaaa-bbbb-4ccc-8ddd-eeeeeeeeeeee")
+	content, err := json.Marshal(triggered)
+	require.NoError(t, err)
+	event, err := drivers.DecodeEvent(content)
+	require.NoError(t, err)
+	assert.NoError(t, Validate(event))
+	event["data"].(map[string]interface{})["executionType"] = "SOMETIMES"
+	var schemaErr *SchemaError
+	assert.ErrorAs(t, Validate(event), &schemaErr)
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This package validates events, against the Eiffel event schemas when there is a schema
+// for the type and version of an event.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+)
+
+// idPattern matches the event IDs that can be requested from the API, which are
+// version 4 UUIDs.
+var idPattern = regexp.MustCompile(`^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[89aAbB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}$`)
+
+// typePattern matches the names of Eiffel event types.
+var typePattern = regexp.MustCompile(`^Eiffel[A-Za-z0-9]+Event$`)
+
+// Validate tests that an event has the fields that all Eiffel events have, with values
+// that the API can handle, and that it matches the schema of its type and version in
+// DefaultSchemas. Events that there is no schema for, e.g. of newer versions than the
+// schemas, are only tested for the fields that all events have.
+func Validate(event drivers.EiffelEvent) error {
+	event, err := decode(event)
+	if err != nil {
+		return err
+	}
+	if err := validateFields(event); err != nil {
+		return err
+	}
+	if err := DefaultSchemas.Validate(event); err != nil && !errors.Is(err, ErrNoSchema) {
+		return err
+	}
+	return nil
+}
+
+// decode returns an event with the types that JSON is decoded into. Events from the
+// databases can have other types, e.g. BSON documents and arrays, which the validation
+// does not know, so they are encoded as JSON and decoded again.
+func decode(event drivers.EiffelEvent) (drivers.EiffelEvent, error) {
+	document, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return drivers.DecodeEvent(document)
+}
+
+// validateFields tests that an event has the fields that all Eiffel events have:
+// meta.id, meta.type, meta.version and meta.time, a data object and links to other events.
+func validateFields(event drivers.EiffelEvent) error {
+	if event == nil {
+		return errors.New("event is not an object")
+	}
+	if _, ok := event["meta"].(map[string]interface{}); !ok {
+		return errors.New("meta is not an object")
+	}
+	id, _ := event.Get("meta.id")
+	if s, ok := id.(string); !ok || !idPattern.MatchString(s) {
+		return fmt.Errorf("meta.id %v is not a version 4 UUID", id)
+	}
+	eventType, _ := event.Get("meta.type")
+	if s, ok := eventType.(string); !ok || !typePattern.MatchString(s) {
+		return fmt.Errorf("meta.type %v is not an Eiffel event type", eventType)
+	}
+	if version, _ := event.Get("meta.version"); version == nil || version == "" {
+		return errors.New("meta.version is missing")
+	} else if _, ok := version.(string); !ok {
+		return fmt.Errorf("meta.version %v is not a string", version)
+	}
+	// Times are epoch milliseconds, which are decoded as int64.
+	if time, _ := event.Get("meta.time"); time == nil {
+		return errors.New("meta.time is missing")
+	} else if _, ok := time.(int64); !ok {
+		return fmt.Errorf("meta.time %v is not an integer", time)
+	}
+	if _, ok := event["data"].(map[string]interface{}); !ok {
+		return errors.New("data is not an object")
+	}
+	links, ok := event["links"].([]interface{})
+	if !ok {
+		return errors.New("links is not an array")
+	}
+	for i, value := range links {
+		link, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("links[%d] is not an object", i)
+		}
+		if linkType, ok := link["type"].(string); !ok || linkType == "" {
+			return fmt.Errorf("links[%d].type %v is not a link type", i, link["type"])
+		}
+		if target, ok := link["target"].(string); !ok || !idPattern.MatchString(target) {
+			return fmt.Errorf("links[%d].target %v is not a version 4 UUID", i, link["target"])
+		}
+	}
+	return nil
+}
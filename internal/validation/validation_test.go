@@ -0,0 +1,97 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+)
+
+const validEvent = `{
+	"meta": {"id": "aaaaaaaa-bbbb-4ccc-8ddd-eeeeeeeeeeee", "type": "EiffelActivityStartedEvent", "version": "4.0.0", "time": 1629449650361},
+	"data": {},
+	"links": [{"type": "ACTIVITY_EXECUTION", "target": "aaaaaaaa-bbbb-4ccc-8ddd-ffffffffffff"}]
+}`
+
+// Test that events without the fields of all Eiffel events are invalid.
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value interface{}
+		err   string
+	}{
+		{"valid", "", nil, ""},
+		{"meta", "meta", "nah", "meta is not an object"},
+		{"id", "meta.id", "nah", "meta.id nah is not a version 4 UUID"},
+		{"type", "meta.type", "ActivityStarted", "meta.type ActivityStarted is not an Eiffel event type"},
+		{"no version", "meta.version", "", "meta.version is missing"},
+		{"version", "meta.version", int64(4), "meta.version 4 is not a string"},
+		{"no time", "meta.time", nil, "meta.time is missing"},
+		{"time", "meta.time", "2021-08-20", "meta.time 2021-08-20 is not an integer"},
+		{"data", "data", []interface{}{}, "data is not an object"},
+		{"links", "links", nil, "links is not an array"},
+		{"link", "links", []interface{}{"nah"}, "links[0] is not an object"},
+		{"link type", "links", []interface{}{map[string]interface{}{"target": "aaaaaaaa-bbbb-4ccc-8ddd-ffffffffffff"}}, "links[0].type <nil> is not a link type"},
+		{"link target", "links", []interface{}{map[string]interface{}{"type": "CAUSE", "target": "nah"}}, "links[0].target nah is not a version 4 UUID"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			event, err := drivers.DecodeEvent([]byte(validEvent))
+			require.NoError(t, err)
+			switch testCase.field {
+			case "":
+			case "meta", "data", "links":
+				event[testCase.field] = testCase.value
+			default:
+				event["meta"].(map[string]interface{})[testCase.field[len("meta."):]] = testCase.value
+			}
+			err = Validate(event)
+			if testCase.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testCase.err)
+			}
+		})
+	}
+	assert.EqualError(t, Validate(nil), "event is not an object")
+}
+
+// Test that events from MongoDB, which are BSON documents, are validated as the JSON
+// encoded events.
+func TestValidateBSON(t *testing.T) {
+	event := drivers.EiffelEvent{
+		"meta": primitive.M{
+			"id":      "aaaaaaaa-bbbb-4ccc-8ddd-eeeeeeeeeeee",
+			"type":    "EiffelActivityStartedEvent",
+			"version": "4.0.0",
+			"time":    int64(1629449650361),
+		},
+		"data": primitive.M{},
+		"links": primitive.A{
+			primitive.M{"type": "ACTIVITY_EXECUTION", "target": "aaaaaaaa-bbbb-4ccc-8ddd-ffffffffffff"},
+		},
+	}
+	assert.NoError(t, Validate(event))
+
+	event["links"] = primitive.A{primitive.M{"type": "CAUSE", "target": "nah"}}
+	assert.EqualError(t, Validate(event), "links[0].target nah is not a version 4 UUID")
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/eiffel-community/eiffel-goer/internal/config"
 	"github.com/eiffel-community/eiffel-goer/internal/database"
 	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/database/federation"
 	"github.com/eiffel-community/eiffel-goer/pkg/server"
 	v1api "github.com/eiffel-community/eiffel-goer/pkg/v1/api"
 )
@@ -65,6 +66,9 @@ func (app *Application) getDB(ctx context.Context) (drivers.Database, error) {
 	if err != nil {
 		return nil, err
 	}
+	if repositories := app.Config.UpstreamRepositories(); len(repositories) > 0 {
+		return federation.New(db, repositories, app.Logger)
+	}
 	return db, nil
 }
 
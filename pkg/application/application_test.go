@@ -24,6 +24,8 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/database/federation"
 	"github.com/eiffel-community/eiffel-goer/test"
 	"github.com/eiffel-community/eiffel-goer/test/mock_config"
 	"github.com/eiffel-community/eiffel-goer/test/mock_drivers"
@@ -36,6 +38,7 @@ func TestGet(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockCfg := mock_config.NewMockConfig(ctrl)
 	mockCfg.EXPECT().DBConnectionString().Return("mongodb://testdb/testdb").Times(2)
+	mockCfg.EXPECT().UpstreamRepositories().Return(nil)
 	mockDriver := mock_drivers.NewMockDatabaseDriver(ctrl)
 	mockDB := mock_drivers.NewMockDatabase(ctrl)
 
@@ -84,6 +87,7 @@ func TestGetDB(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockCfg := mock_config.NewMockConfig(ctrl)
 	mockCfg.EXPECT().DBConnectionString().Return("mongodb://testdb/testdb")
+	mockCfg.EXPECT().UpstreamRepositories().Return(nil)
 
 	mockDriver := mock_drivers.NewMockDatabaseDriver(ctrl)
 	mockDB := mock_drivers.NewMockDatabase(ctrl)
@@ -100,12 +104,38 @@ func TestGetDB(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// Test that getDB combines the database with upstream repositories when there are any.
+func TestGetDBFederation(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	mockCfg := mock_config.NewMockConfig(ctrl)
+	mockCfg.EXPECT().DBConnectionString().Return("mongodb://testdb/testdb")
+	mockCfg.EXPECT().UpstreamRepositories().Return([]string{"http://goer.example.com/v1"})
+
+	mockDriver := mock_drivers.NewMockDatabaseDriver(ctrl)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	mockDriver.EXPECT().SupportsScheme("mongodb").Return(true)
+	mockDriver.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).Return(mockDB, nil)
+	test.SetDatabaseDriver(mockDriver)
+	defer test.ResetDatabaseDriver()
+
+	application := &Application{
+		Config: mockCfg,
+	}
+
+	db, err := application.getDB(ctx)
+	assert.NoError(t, err)
+	assert.IsType(t, &federation.Database{}, db)
+	assert.Equal(t, mockDB, drivers.Local(db))
+}
+
 // Test that the application creates the v1 subrouter.
 func TestLoadV1Routes(t *testing.T) {
 	ctx := context.Background()
 	ctrl := gomock.NewController(t)
 	mockCfg := mock_config.NewMockConfig(ctrl)
 	mockCfg.EXPECT().DBConnectionString().Return("mongodb://testdb/testdb").Times(2)
+	mockCfg.EXPECT().UpstreamRepositories().Return(nil)
 
 	mockDriver := mock_drivers.NewMockDatabaseDriver(ctrl)
 	mockDB := mock_drivers.NewMockDatabase(ctrl)
@@ -137,6 +167,7 @@ func TestStart(t *testing.T) {
 
 	mockDB.EXPECT().Close(gomock.Any()).Return(nil)
 	mockCfg.EXPECT().DBConnectionString().Return("mongodb://testdb/testdb").Times(2)
+	mockCfg.EXPECT().UpstreamRepositories().Return(nil)
 	mockCfg.EXPECT().APIPort().Return(":8080")
 
 	app, err := Get(ctx, mockCfg, &log.Entry{})
@@ -169,6 +200,7 @@ func TestStartFail(t *testing.T) {
 
 	mockDB.EXPECT().Close(gomock.Any()).Return(nil)
 	mockCfg.EXPECT().DBConnectionString().Return("mongodb://testdb/testdb").Times(2)
+	mockCfg.EXPECT().UpstreamRepositories().Return(nil)
 	mockCfg.EXPECT().APIPort().Return("")
 
 	app, err := Get(ctx, mockCfg, &log.Entry{})
@@ -198,6 +230,7 @@ func TestStop(t *testing.T) {
 
 	mockDB.EXPECT().Close(gomock.Any()).Return(nil)
 	mockCfg.EXPECT().DBConnectionString().Return("mongodb://testdb/testdb").Times(2)
+	mockCfg.EXPECT().UpstreamRepositories().Return(nil)
 
 	app, err := Get(ctx, mockCfg, &log.Entry{})
 	assert.NoError(t, err)
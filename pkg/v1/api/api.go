@@ -38,6 +38,10 @@ func (app *V1Application) AddRoutes(router *mux.Router) {
 	searchHandler := search.Get(app.Config, app.Database, app.Logger)
 
 	router.HandleFunc("/events", eventHandler.ReadAll).Methods("GET", "OPTIONS")
+	router.HandleFunc("/events", eventHandler.Create).Methods("POST")
 	router.HandleFunc("/events/{id:[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}}", eventHandler.Read).Methods("GET", "OPTIONS")
+	router.HandleFunc("/events/{id:[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}}/validate", eventHandler.Validate).Methods("GET")
+	router.HandleFunc("/search/path", searchHandler.Path).Methods("GET")
 	router.HandleFunc("/search/{id:[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}}", searchHandler.UpstreamDownstream).Methods("POST", "OPTIONS")
+	router.HandleFunc("/search/{id:[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}}", searchHandler.UpstreamDownstreamQuery).Methods("GET", "OPTIONS")
 }
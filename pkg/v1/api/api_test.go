@@ -65,7 +65,11 @@ func TestRoutes(t *testing.T) {
 	}{
 		{name: "EventsRead", httpMethod: http.MethodGet, url: "/v1/events/" + eventID, statusCode: http.StatusOK},
 		{name: "EventsReadAll", httpMethod: http.MethodGet, url: "/v1/events?meta.type=EiffelArtifactCreatedEvent", statusCode: http.StatusOK},
-		{name: "SearchUpstreamDownstream", httpMethod: http.MethodPost, url: "/v1/search/" + eventID, statusCode: http.StatusNotImplemented},
+		{name: "EventsValidate", httpMethod: http.MethodGet, url: "/v1/events/" + eventID + "/validate", statusCode: http.StatusOK},
+		{name: "EventsCreate", httpMethod: http.MethodPost, url: "/v1/events", statusCode: http.StatusForbidden},
+		{name: "SearchUpstreamDownstream", httpMethod: http.MethodPost, url: "/v1/search/" + eventID, statusCode: http.StatusOK},
+		{name: "SearchPath", httpMethod: http.MethodGet, url: "/v1/search/path?from=" + eventID + "&to=" + eventID, statusCode: http.StatusOK},
+		{name: "SearchUpstreamDownstreamQuery", httpMethod: http.MethodGet, url: "/v1/search/" + eventID + "?dlt=CAUSE", statusCode: http.StatusOK},
 	}
 
 	ctrl := gomock.NewController(t)
@@ -74,13 +78,14 @@ func TestRoutes(t *testing.T) {
 
 	mockCfg.EXPECT().DBConnectionString().Return("").AnyTimes()
 	mockCfg.EXPECT().APIPort().Return(":8080").AnyTimes()
+	mockCfg.EXPECT().PublishTokens().Return(nil)
 	var count int64 = 1
 
 	// Have to use 'gomock.Any()' for the context as mux adds values to the request context.
-	mockDB.EXPECT().GetEventByID(gomock.Any(), eventID).Return(eventMap, nil)
+	mockDB.EXPECT().GetEventByID(gomock.Any(), eventID).Return(eventMap, nil).Times(2)
 	mockDB.EXPECT().GetEvents(gomock.Any(), gomock.Any()).Return([]drivers.EiffelEvent{eventMap}, count, nil)
-	// Disabled as SearchUpstreamDownstream is not yet implemented.
-	// mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), "id").Return([]drivers.EiffelEvent{}, nil)
+	mockDB.EXPECT().ShortestPath(gomock.Any(), gomock.Any()).Return(drivers.Path{}, nil)
+	mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), eventID, gomock.Any()).Return(drivers.SearchResult{}, nil).Times(2)
 
 	for _, testCase := range tests {
 		t.Run(testCase.name, func(t *testing.T) {
@@ -16,9 +16,15 @@
 package events
 
 import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"reflect"
+	"net/url"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
@@ -26,11 +32,14 @@ import (
 
 	"github.com/eiffel-community/eiffel-goer/internal/config"
 	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
-	"github.com/eiffel-community/eiffel-goer/internal/query"
 	"github.com/eiffel-community/eiffel-goer/internal/requests"
 	"github.com/eiffel-community/eiffel-goer/internal/responses"
+	"github.com/eiffel-community/eiffel-goer/internal/validation"
 )
 
+// maxPublishSize is the largest request body, in bytes, that events can be published with.
+const maxPublishSize = 16 << 20
+
 type EventHandler struct {
 	Config   config.Config
 	Database drivers.Database
@@ -52,25 +61,73 @@ func (h *EventHandler) Read(w http.ResponseWriter, r *http.Request) {
 		responses.RespondWithError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
 		return
 	}
+	db := h.Database
+	if request.Shallow {
+		db = drivers.Local(db)
+	}
 	vars := mux.Vars(r)
 	ID := vars["id"]
-	event, err := h.Database.GetEventByID(r.Context(), ID)
-	if err != nil {
+	event, err := db.GetEventByID(r.Context(), ID)
+	if errors.Is(err, drivers.ErrEventNotFound) {
 		responses.RespondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
 		return
+	} else if err != nil {
+		h.Logger.Error(err)
+		responses.RespondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	event = event.Project(request.Fields)
+	if request.Readable {
+		event = event.Readable()
 	}
 	responses.RespondWithJSON(w, http.StatusOK, event)
 }
 
-func getTags(tagName string, item interface{}) map[string]struct{} {
-	t := reflect.TypeOf(item).Elem()
-	tags := make(map[string]struct{})
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get(tagName)
-		tags[tag] = struct{}{}
+type validateResponse struct {
+	ID     string   `json:"id"`
+	Valid  bool     `json:"valid"`
+	Schema string   `json:"schema,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Validate handles GET requests against the /events/{id}/validate endpoint.
+// To validate a stored event against the Eiffel event schema of its type and version.
+func (h *EventHandler) Validate(w http.ResponseWriter, r *http.Request) {
+	var request requests.SingleEventRequest
+	if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
+		responses.RespondWithError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+	db := h.Database
+	if request.Shallow {
+		db = drivers.Local(db)
+	}
+	event, err := db.GetEventByID(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, drivers.ErrEventNotFound) {
+		responses.RespondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	} else if err != nil {
+		h.Logger.Error(err)
+		responses.RespondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	version, _ := event.Get("meta.version")
+	versionString, _ := version.(string)
+	response := validateResponse{
+		ID:     event.ID(),
+		Valid:  true,
+		Schema: validation.DefaultSchemas.Name(event.Type(), versionString),
+	}
+	if err := validation.Validate(event); err != nil {
+		response.Valid = false
+		var schemaErr *validation.SchemaError
+		if errors.As(err, &schemaErr) {
+			response.Errors = schemaErr.Problems
+		} else {
+			response.Errors = []string{err.Error()}
+		}
 	}
-	return tags
+	responses.RespondWithJSON(w, http.StatusOK, response)
 }
 
 type multiResponse struct {
@@ -78,29 +135,25 @@ type multiResponse struct {
 	PageSize         int                   `json:"pageSize"`
 	TotalNumberItems int64                 `json:"totalNumberItems"`
 	Items            []drivers.EiffelEvent `json:"items"`
+	Cursor           string                `json:"cursor,omitempty"`
+	Next             string                `json:"next,omitempty"`
 }
 
-// buildConditions takes a raw URL query, parses out all conditions and removes ignoreKeys.
-func buildConditions(rawQuery string, ignoreKeys map[string]struct{}) ([]query.Condition, error) {
-	if rawQuery == "" {
-		return nil, nil
-	}
-	res, err := query.Parse("nofile", []byte(rawQuery))
-	if err != nil {
-		return nil, err
-	}
-	allConditions, ok := res.([]query.Condition)
-	if !ok {
-		return nil, fmt.Errorf("query parser unexpectedly returned a %T value from the query %q", res, rawQuery)
-	}
-	var conditions []query.Condition
-	for _, condition := range allConditions {
-		_, ok := ignoreKeys[condition.Field]
-		if !ok {
-			conditions = append(conditions, condition)
+// nextLink returns a link to the same query as a request, but at the position of a cursor,
+// which replaces the page number and start item.
+// The raw query is edited instead of parsed and encoded again, since that would escape
+// the parentheses and operators of conditions.
+func nextLink(u *url.URL, cursor string) string {
+	var parameters []string
+	for _, parameter := range strings.Split(u.RawQuery, "&") {
+		if parameter == "" || strings.HasPrefix(parameter, "cursor=") ||
+			strings.HasPrefix(parameter, "pageNo=") || strings.HasPrefix(parameter, "pageStartItem=") {
+			continue
 		}
+		parameters = append(parameters, parameter)
 	}
-	return conditions, nil
+	parameters = append(parameters, "cursor="+cursor)
+	return u.Path + "?" + strings.Join(parameters, "&")
 }
 
 // ReadAll handles GET requests against the /events/ endpoint.
@@ -125,16 +178,54 @@ func (h *EventHandler) ReadAll(w http.ResponseWriter, r *http.Request) {
 		responses.RespondWithError(w, http.StatusBadRequest, "PageSize must be a positive integer")
 		return
 	}
+	if request.PageNo < 1 {
+		responses.RespondWithError(w, http.StatusBadRequest, "PageNo must be a positive integer")
+		return
+	}
+	if request.PageStartItem < 1 {
+		responses.RespondWithError(w, http.StatusBadRequest, "PageStartItem must be a positive integer")
+		return
+	}
+	if request.PageStartItem > 1 && request.PageNo > 1 {
+		responses.RespondWithError(w, http.StatusBadRequest, "PageStartItem can only be used on the first page")
+		return
+	}
+	if !request.Cursor.IsZero() {
+		if request.Lazy {
+			responses.RespondWithError(w, http.StatusBadRequest, "Lazy can not be used with a cursor")
+			return
+		}
+		if request.PageNo != 1 {
+			responses.RespondWithError(w, http.StatusBadRequest, "PageNo can not be used with a cursor")
+			return
+		}
+		if request.PageStartItem != 1 {
+			responses.RespondWithError(w, http.StatusBadRequest, "PageStartItem can not be used with a cursor")
+			return
+		}
+		if request.Sort != nil && request.Sort.String() != request.Cursor.Sort.String() {
+			responses.RespondWithError(w, http.StatusBadRequest, "Sort can not be changed when paging with a cursor")
+			return
+		}
+		if len(request.Cursor.After) != len(drivers.OrderBy(request.Cursor.Sort)) {
+			responses.RespondWithError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		request.Sort = request.Cursor.Sort
+	}
 
-	ignoreKeys := getTags("schema", &request)
-	conditions, err := buildConditions(r.URL.RawQuery, ignoreKeys)
+	conditions, err := requests.BuildConditions(r.URL.RawQuery, requests.SchemaTags(&request))
 	if err != nil {
 		h.Logger.Error(err)
 		responses.RespondWithError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
 		return
 	}
 	request.Conditions = conditions
-	events, totalNumberItems, err := h.Database.GetEvents(r.Context(), request)
+	db := h.Database
+	if request.Shallow {
+		db = drivers.Local(db)
+	}
+	events, totalNumberItems, err := db.GetEvents(r.Context(), request)
 	if err != nil {
 		h.Logger.Error(err)
 		responses.RespondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
@@ -149,6 +240,128 @@ func (h *EventHandler) ReadAll(w http.ResponseWriter, r *http.Request) {
 		request.PageSize,
 		totalNumberItems,
 		events,
+		"",
+		"",
+	}
+	// Lazy pages are not in one global order, so there is no position to continue from.
+	if len(events) == request.PageSize && !request.Lazy {
+		if cursor, ok := drivers.CursorAfter(events[len(events)-1], request.Sort); ok {
+			token, err := cursor.MarshalText()
+			if err != nil {
+				h.Logger.Error(err)
+				responses.RespondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				return
+			}
+			response.Cursor = string(token)
+			response.Next = nextLink(r.URL, response.Cursor)
+		}
+	}
+	// The cursor is created first, since it needs the values of the sort keys as stored.
+	for i, event := range response.Items {
+		response.Items[i] = event.Project(request.Fields)
+		if request.Readable {
+			response.Items[i] = response.Items[i].Readable()
+		}
 	}
 	responses.RespondWithJSON(w, http.StatusOK, response)
 }
+
+type publishResponse struct {
+	IDs []string `json:"ids"`
+}
+
+// authorized tests whether a request has one of the publish tokens as a bearer token.
+func authorized(r *http.Request, tokens []string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	authorized := false
+	for _, allowed := range tokens {
+		// Compare with every token in constant time, not to leak how much of a token is correct.
+		if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			authorized = true
+		}
+	}
+	return authorized
+}
+
+// decodeEvents decodes a request body with an event or an array of events.
+func decodeEvents(body []byte) ([]drivers.EiffelEvent, error) {
+	body = bytes.TrimSpace(body)
+	if !bytes.HasPrefix(body, []byte("[")) {
+		event, err := drivers.DecodeEvent(body)
+		if err != nil {
+			return nil, err
+		}
+		return []drivers.EiffelEvent{event}, nil
+	}
+	var documents []json.RawMessage
+	if err := json.Unmarshal(body, &documents); err != nil {
+		return nil, err
+	}
+	events := make([]drivers.EiffelEvent, 0, len(documents))
+	for i, document := range documents {
+		event, err := drivers.DecodeEvent(document)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Create handles POST requests against the /events endpoint.
+// To publish an event, or an array of events, that is stored in the database.
+// No events are stored unless all of them are valid. Whether a failure to store them can
+// leave some of them stored depends on the database, but publishing them again is safe.
+func (h *EventHandler) Create(w http.ResponseWriter, r *http.Request) {
+	tokens := h.Config.PublishTokens()
+	if len(tokens) == 0 {
+		responses.RespondWithError(w, http.StatusForbidden, "Publishing events is disabled")
+		return
+	}
+	if !authorized(r, tokens) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		responses.RespondWithError(w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPublishSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			responses.RespondWithError(w, http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+			return
+		}
+		responses.RespondWithError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+	events, err := decodeEvents(body)
+	if err != nil {
+		responses.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(events) == 0 {
+		responses.RespondWithError(w, http.StatusBadRequest, "No events to publish")
+		return
+	}
+	response := publishResponse{IDs: make([]string, 0, len(events))}
+	for i, event := range events {
+		if err := validation.Validate(event); err != nil {
+			responses.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("event %d: %v", i, err))
+			return
+		}
+		response.IDs = append(response.IDs, event.ID())
+	}
+	if err := drivers.Insert(r.Context(), h.Database, events...); err != nil {
+		if errors.Is(err, drivers.ErrReadOnly) {
+			w.Header().Set("Allow", "GET, OPTIONS")
+			responses.RespondWithError(w, http.StatusMethodNotAllowed, "The database is read-only")
+			return
+		}
+		h.Logger.Error(err)
+		responses.RespondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	responses.RespondWithJSON(w, http.StatusCreated, response)
+}
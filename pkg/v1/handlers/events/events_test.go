@@ -16,10 +16,17 @@
 package events
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/eiffel-community/eiffelevents-sdk-go"
@@ -30,6 +37,10 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers/memory"
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers/sqlite"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+	"github.com/eiffel-community/eiffel-goer/internal/validation"
 	"github.com/eiffel-community/eiffel-goer/test/mock_config"
 	"github.com/eiffel-community/eiffel-goer/test/mock_drivers"
 )
@@ -75,7 +86,8 @@ func TestEvents(t *testing.T) {
 	}{
 		{name: "Read", request: httptest.NewRequest(http.MethodGet, "/events/"+eventID, nil), statusCode: http.StatusOK, eventID: eventID, expectCall: true},
 		{name: "ReadBadRequest", request: badRequest, statusCode: http.StatusBadRequest, eventID: "", expectCall: false},
-		{name: "ReadNotFound", request: httptest.NewRequest(http.MethodGet, "/events/"+eventID, nil), statusCode: http.StatusNotFound, eventID: "", mockError: errors.New("not found"), expectCall: true},
+		{name: "ReadNotFound", request: httptest.NewRequest(http.MethodGet, "/events/"+eventID, nil), statusCode: http.StatusNotFound, eventID: "", mockError: fmt.Errorf("%q: %w", eventID, drivers.ErrEventNotFound), expectCall: true},
+		{name: "ReadError", request: httptest.NewRequest(http.MethodGet, "/events/"+eventID, nil), statusCode: http.StatusInternalServerError, eventID: "", mockError: errors.New("connection refused"), expectCall: true},
 	}
 
 	for _, testCase := range tests {
@@ -86,7 +98,7 @@ func TestEvents(t *testing.T) {
 			if testCase.expectCall {
 				mockDB.EXPECT().GetEventByID(gomock.Any(), eventID).Return(eventMap, testCase.mockError)
 			}
-			app := Get(mockCfg, mockDB, &log.Entry{})
+			app := Get(mockCfg, mockDB, log.NewEntry(log.New()))
 			handler := mux.NewRouter()
 			handler.HandleFunc("/events/{id:[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}}", app.Read)
 
@@ -100,3 +112,398 @@ func TestEvents(t *testing.T) {
 		})
 	}
 }
+
+// Test that the events endpoint validates paging and passes the sort order to the database.
+func TestEventsReadAll(t *testing.T) {
+	eventMap := make(drivers.EiffelEvent)
+	require.NoError(t, json.Unmarshal(activityJSON, &eventMap))
+
+	tests := []struct {
+		name       string
+		url        string
+		statusCode int
+		sort       requests.Sort
+	}{
+		{name: "Unsorted", url: "/events", statusCode: http.StatusOK},
+		{
+			name:       "Sorted",
+			url:        "/events?sort=-meta.time,meta.type&meta.type=EiffelActivityTriggeredEvent",
+			statusCode: http.StatusOK,
+			sort:       requests.Sort{{Field: "meta.time", Descending: true}, {Field: "meta.type"}},
+		},
+		{name: "BadField", url: "/events?sort=meta.$where", statusCode: http.StatusBadRequest},
+		{name: "EmptyField", url: "/events?sort=meta.time,", statusCode: http.StatusBadRequest},
+		{name: "BadPageNo", url: "/events?pageNo=0", statusCode: http.StatusBadRequest},
+		{name: "BadPageSize", url: "/events?pageSize=-1", statusCode: http.StatusBadRequest},
+		{name: "PageStartItem", url: "/events?pageStartItem=10", statusCode: http.StatusOK},
+		{name: "BadPageStartItem", url: "/events?pageStartItem=0", statusCode: http.StatusBadRequest},
+		{name: "PageStartItemOnLaterPage", url: "/events?pageStartItem=10&pageNo=2", statusCode: http.StatusBadRequest},
+		{name: "Lazy", url: "/events?lazy=true&pageNo=3", statusCode: http.StatusOK},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockCfg := mock_config.NewMockConfig(ctrl)
+			mockDB := mock_drivers.NewMockDatabase(ctrl)
+			if testCase.statusCode == http.StatusOK {
+				mockDB.EXPECT().GetEvents(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+						assert.Equal(t, testCase.sort, request.Sort)
+						// The sort parameter must not be mistaken for a condition.
+						for _, condition := range request.Conditions {
+							assert.NotEqual(t, "sort", condition.Field)
+						}
+						return []drivers.EiffelEvent{eventMap}, 1, nil
+					})
+			}
+			app := Get(mockCfg, mockDB, log.NewEntry(log.New()))
+			responseRecorder := httptest.NewRecorder()
+			app.ReadAll(responseRecorder, httptest.NewRequest(http.MethodGet, testCase.url, nil))
+			assert.Equal(t, testCase.statusCode, responseRecorder.Code)
+		})
+	}
+}
+
+// Test that full pages link to the next page with a cursor, which is passed to the database.
+func TestEventsCursor(t *testing.T) {
+	eventMap := make(drivers.EiffelEvent)
+	require.NoError(t, json.Unmarshal(activityJSON, &eventMap))
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	app := Get(mock_config.NewMockConfig(ctrl), mockDB, log.NewEntry(log.New()))
+
+	var received requests.MultipleEventsRequest
+	mockDB.EXPECT().GetEvents(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+			received = request
+			return []drivers.EiffelEvent{eventMap}, 2, nil
+		}).Times(2)
+
+	responseRecorder := httptest.NewRecorder()
+	app.ReadAll(responseRecorder, httptest.NewRequest(http.MethodGet, "/events?pageSize=1&sort=-meta.time&int(meta.time)%3E=5&pageNo=1", nil))
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	var response multiResponse
+	require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &response))
+	require.NotEmpty(t, response.Cursor)
+	assert.Equal(t, "/events?pageSize=1&sort=-meta.time&int(meta.time)%3E=5&cursor="+response.Cursor, response.Next)
+	assert.True(t, received.Cursor.IsZero())
+
+	responseRecorder = httptest.NewRecorder()
+	app.ReadAll(responseRecorder, httptest.NewRequest(http.MethodGet, response.Next, nil))
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.Equal(t, requests.Sort{{Field: "meta.time", Descending: true}}, received.Sort)
+	assert.Equal(t, []interface{}{int64(1629449650361), "e04cf9d3-4d57-471e-bd65-f8fc20d21d84"}, received.Cursor.After)
+	require.Len(t, received.Conditions, 1)
+	assert.Equal(t, "meta.time", received.Conditions[0].Field)
+
+	// Lazy pages have no cursor.
+	mockDB.EXPECT().GetEvents(gomock.Any(), gomock.Any()).Return([]drivers.EiffelEvent{eventMap}, int64(1), nil)
+	responseRecorder = httptest.NewRecorder()
+	app.ReadAll(responseRecorder, httptest.NewRequest(http.MethodGet, "/events?pageSize=1&lazy=true", nil))
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.NotContains(t, responseRecorder.Body.String(), "cursor")
+
+	for _, url := range []string{
+		"/events?cursor=" + response.Cursor + "&pageNo=2",
+		"/events?cursor=" + response.Cursor + "&pageStartItem=2",
+		"/events?cursor=" + response.Cursor + "&sort=meta.time",
+		"/events?cursor=garbage",
+		"/events?cursor=" + response.Cursor + "&lazy=true",
+	} {
+		responseRecorder = httptest.NewRecorder()
+		app.ReadAll(responseRecorder, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equalf(t, http.StatusBadRequest, responseRecorder.Code, "URL: %s", url)
+	}
+}
+
+// Test that events are projected to the requested fields.
+func TestEventsFields(t *testing.T) {
+	eventMap := make(drivers.EiffelEvent)
+	require.NoError(t, json.Unmarshal(activityJSON, &eventMap))
+	eventID := "e04cf9d3-4d57-471e-bd65-f8fc20d21d84"
+	expected := `{"meta": {"id": "e04cf9d3-4d57-471e-bd65-f8fc20d21d84", "type": "EiffelActivityTriggeredEvent"}}`
+
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	app := Get(mock_config.NewMockConfig(ctrl), mockDB, log.NewEntry(log.New()))
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}", app.Read)
+
+	mockDB.EXPECT().GetEventByID(gomock.Any(), eventID).Return(eventMap, nil)
+	responseRecorder := httptest.NewRecorder()
+	router.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/events/"+eventID+"?fields=meta.id,meta.type", nil))
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.JSONEq(t, expected, responseRecorder.Body.String())
+
+	mockDB.EXPECT().GetEvents(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, request requests.MultipleEventsRequest) ([]drivers.EiffelEvent, int64, error) {
+			assert.Equal(t, requests.Fields{"meta.id", "meta.type"}, request.Fields)
+			return []drivers.EiffelEvent{eventMap}, 1, nil
+		})
+	responseRecorder = httptest.NewRecorder()
+	app.ReadAll(responseRecorder, httptest.NewRequest(http.MethodGet, "/events?fields=meta.id,meta.type&pageSize=1&sort=meta.time", nil))
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	var response multiResponse
+	require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &response))
+	require.Len(t, response.Items, 1)
+	items, err := json.Marshal(response.Items[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, string(items))
+	// The cursor has the sort key, even though it is not in the fields.
+	var cursor requests.Cursor
+	require.NoError(t, cursor.UnmarshalText([]byte(response.Cursor)))
+	assert.Equal(t, []interface{}{int64(1629449650361), eventID}, cursor.After)
+
+	responseRecorder = httptest.NewRecorder()
+	router.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/events/"+eventID+"?fields=meta.$where", nil))
+	assert.Equal(t, http.StatusBadRequest, responseRecorder.Code)
+}
+
+// Test that the readable parameter makes event times readable.
+func TestEventsReadable(t *testing.T) {
+	eventMap := make(drivers.EiffelEvent)
+	require.NoError(t, json.Unmarshal(activityJSON, &eventMap))
+	eventID := "e04cf9d3-4d57-471e-bd65-f8fc20d21d84"
+	expected := `{"meta": {"id": "e04cf9d3-4d57-471e-bd65-f8fc20d21d84", "time": "2021-08-20T08:54:10.361Z"}}`
+
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	app := Get(mock_config.NewMockConfig(ctrl), mockDB, log.NewEntry(log.New()))
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}", app.Read)
+
+	mockDB.EXPECT().GetEventByID(gomock.Any(), eventID).Return(eventMap, nil)
+	responseRecorder := httptest.NewRecorder()
+	router.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/events/"+eventID+"?readable=true&fields=meta.id,meta.time", nil))
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.JSONEq(t, expected, responseRecorder.Body.String())
+
+	mockDB.EXPECT().GetEvents(gomock.Any(), gomock.Any()).Return([]drivers.EiffelEvent{eventMap}, int64(1), nil)
+	responseRecorder = httptest.NewRecorder()
+	app.ReadAll(responseRecorder, httptest.NewRequest(http.MethodGet, "/events?readable=true&fields=meta.id,meta.time&pageSize=1&sort=meta.time", nil))
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	var response multiResponse
+	require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &response))
+	require.Len(t, response.Items, 1)
+	items, err := json.Marshal(response.Items[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, string(items))
+	// The cursor has the time as stored, not the readable time.
+	var cursor requests.Cursor
+	require.NoError(t, cursor.UnmarshalText([]byte(response.Cursor)))
+	assert.Equal(t, []interface{}{int64(1629449650361), eventID}, cursor.After)
+
+	// The event from the database must not be modified.
+	time, _ := eventMap.Get("meta.time")
+	assert.Equal(t, 1629449650361.0, time)
+}
+
+// Test that all events are read, page by page, from a real database.
+func TestEventsSQLite(t *testing.T) {
+	ctx := context.Background()
+	connectionURL, err := url.Parse("sqlite://" + filepath.Join(t.TempDir(), "events.db"))
+	require.NoError(t, err)
+	db, err := (&sqlite.Driver{}).Get(ctx, connectionURL, log.NewEntry(log.New()))
+	require.NoError(t, err)
+	defer db.Close(ctx)
+	var expected []string
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("e04cf9d3-4d57-471e-bd65-f8fc20d21d8%d", i)
+		expected = append(expected, id)
+		require.NoError(t, db.(*sqlite.Database).Insert(ctx, drivers.EiffelEvent{
+			"meta": map[string]interface{}{"id": id, "type": "EiffelActivityTriggeredEvent", "time": 1629449650361 - i},
+		}))
+	}
+	app := Get(mock_config.NewMockConfig(gomock.NewController(t)), db, log.NewEntry(log.New()))
+	slices.Reverse(expected)
+
+	pages, got := readAll(t, app, "/events?pageSize=2&sort=meta.time&meta.type=EiffelActivityTriggeredEvent")
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, expected, got)
+
+	// The start item only applies to the first page, and the next pages continue after it.
+	pages, got = readAll(t, app, "/events?pageSize=1&pageStartItem=3&pageNo=1&sort=meta.time")
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, expected[2:], got)
+}
+
+// readAll follows the next links from a URL and returns the number of pages and the IDs
+// of the events on them.
+func readAll(t *testing.T, app *EventHandler, next string) (int, []string) {
+	t.Helper()
+	var got []string
+	pages := 0
+	for next != "" {
+		responseRecorder := httptest.NewRecorder()
+		app.ReadAll(responseRecorder, httptest.NewRequest(http.MethodGet, next, nil))
+		if responseRecorder.Code == http.StatusNotFound && pages > 0 {
+			// The last page was full, so it linked to a page without events.
+			break
+		}
+		require.Equal(t, http.StatusOK, responseRecorder.Code)
+		var response multiResponse
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &response))
+		assert.Equal(t, int64(5), response.TotalNumberItems)
+		for _, item := range response.Items {
+			got = append(got, item.ID())
+		}
+		pages++
+		next = response.Next
+	}
+	return pages, got
+}
+
+// Test that events are published when they are valid and the request is authorized.
+func TestEventsCreate(t *testing.T) {
+	second := strings.Replace(string(activityJSON), "e04cf9d3-4d57-471e-bd65-f8fc20d21d84", "e04cf9d3-4d57-471e-bd65-f8fc20d21d85", 1)
+	invalid := strings.Replace(string(activityJSON), `"links": [],`, "", 1)
+	tests := []struct {
+		name          string
+		tokens        []string
+		authorization string
+		body          string
+		readOnly      bool
+		statusCode    int
+		stored        []string
+	}{
+		{name: "Single", tokens: []string{"secret"}, authorization: "Bearer secret", body: string(activityJSON), statusCode: http.StatusCreated, stored: []string{"e04cf9d3-4d57-471e-bd65-f8fc20d21d84"}},
+		{name: "Batch", tokens: []string{"other", "secret"}, authorization: "Bearer secret", body: "[" + string(activityJSON) + "," + second + "]", statusCode: http.StatusCreated, stored: []string{"e04cf9d3-4d57-471e-bd65-f8fc20d21d84", "e04cf9d3-4d57-471e-bd65-f8fc20d21d85"}},
+		{name: "Disabled", body: string(activityJSON), statusCode: http.StatusForbidden},
+		{name: "Unauthenticated", tokens: []string{"secret"}, body: string(activityJSON), statusCode: http.StatusUnauthorized},
+		{name: "WrongToken", tokens: []string{"secret"}, authorization: "Bearer secrets", body: string(activityJSON), statusCode: http.StatusUnauthorized},
+		{name: "BadJSON", tokens: []string{"secret"}, authorization: "Bearer secret", body: "{", statusCode: http.StatusBadRequest},
+		{name: "Empty", tokens: []string{"secret"}, authorization: "Bearer secret", body: "[]", statusCode: http.StatusBadRequest},
+		{name: "Invalid", tokens: []string{"secret"}, authorization: "Bearer secret", body: "[" + string(activityJSON) + "," + invalid + "]", statusCode: http.StatusBadRequest},
+		{name: "TooLarge", tokens: []string{"secret"}, authorization: "Bearer secret", body: strings.Repeat(" ", maxPublishSize+1), statusCode: http.StatusRequestEntityTooLarge},
+		{name: "ReadOnly", tokens: []string{"secret"}, authorization: "Bearer secret", body: string(activityJSON), readOnly: true, statusCode: http.StatusMethodNotAllowed},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockCfg := mock_config.NewMockConfig(ctrl)
+			mockCfg.EXPECT().PublishTokens().Return(testCase.tokens)
+			db := memory.New(log.NewEntry(log.New()))
+			var database drivers.Database = db
+			if testCase.readOnly {
+				// The mocked database has no Insert method.
+				database = mock_drivers.NewMockDatabase(ctrl)
+			}
+			app := Get(mockCfg, database, log.NewEntry(log.New()))
+
+			request := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(testCase.body))
+			if testCase.authorization != "" {
+				request.Header.Set("Authorization", testCase.authorization)
+			}
+			responseRecorder := httptest.NewRecorder()
+			app.Create(responseRecorder, request)
+
+			assert.Equal(t, testCase.statusCode, responseRecorder.Code, responseRecorder.Body.String())
+			assert.Equal(t, len(testCase.stored), db.Len())
+			if testCase.statusCode == http.StatusCreated {
+				var response publishResponse
+				require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &response))
+				assert.Equal(t, testCase.stored, response.IDs)
+				event, err := db.GetEventByID(context.Background(), testCase.stored[0])
+				require.NoError(t, err)
+				time, _ := event.Get("meta.time")
+				assert.Equal(t, int64(1629449650361), time)
+			}
+			if testCase.statusCode == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", responseRecorder.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+// Test that stored events are validated against the schema of their type and version,
+// and that events that do not match their schema are not published.
+func TestEventsValidate(t *testing.T) {
+	defaultSchemas := validation.DefaultSchemas
+	defer func() { validation.DefaultSchemas = defaultSchemas }()
+	validation.DefaultSchemas = validation.NewSchemas(os.DirFS("../../../../internal/validation/testdata/schemas"))
+
+	eventID := "e04cf9d3-4d57-471e-bd65-f8fc20d21d84"
+	tests := []struct {
+		name       string
+		modify     func(event drivers.EiffelEvent)
+		statusCode int
+		response   validateResponse
+	}{
+		{
+			name:       "Valid",
+			modify:     func(event drivers.EiffelEvent) {},
+			statusCode: http.StatusOK,
+			response:   validateResponse{ID: eventID, Valid: true, Schema: "EiffelActivityTriggeredEvent/3.0.0"},
+		},
+		{
+			name:       "Invalid",
+			modify:     func(event drivers.EiffelEvent) { event["data"] = map[string]interface{}{} },
+			statusCode: http.StatusOK,
+			response: validateResponse{ID: eventID, Valid: false, Schema: "EiffelActivityTriggeredEvent/3.0.0",
+				Errors: []string{"/data: missing properties: 'name'"}},
+		},
+		{
+			name:       "NoSchema",
+			modify:     func(event drivers.EiffelEvent) { event["meta"].(map[string]interface{})["version"] = "4.0.0" },
+			statusCode: http.StatusOK,
+			response:   validateResponse{ID: eventID, Valid: true},
+		},
+		{
+			name:       "NoLinks",
+			modify:     func(event drivers.EiffelEvent) { delete(event, "links") },
+			statusCode: http.StatusOK,
+			response: validateResponse{ID: eventID, Valid: false, Schema: "EiffelActivityTriggeredEvent/3.0.0",
+				Errors: []string{"links is not an array"}},
+		},
+		{
+			name:       "NotFound",
+			statusCode: http.StatusNotFound,
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			db := memory.New(log.NewEntry(log.New()))
+			if testCase.modify != nil {
+				event, err := drivers.DecodeEvent(activityJSON)
+				require.NoError(t, err)
+				testCase.modify(event)
+				require.NoError(t, db.Insert(context.Background(), event))
+			}
+			app := Get(mock_config.NewMockConfig(gomock.NewController(t)), db, log.NewEntry(log.New()))
+			handler := mux.NewRouter()
+			handler.HandleFunc("/events/{id}/validate", app.Validate)
+
+			responseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/events/"+eventID+"/validate", nil))
+
+			require.Equal(t, testCase.statusCode, responseRecorder.Code)
+			if responseRecorder.Code == http.StatusOK {
+				var response validateResponse
+				require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &response))
+				assert.Equal(t, testCase.response, response)
+			}
+		})
+	}
+
+	// Errors other than a missing event are not reported as one.
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	mockDB.EXPECT().GetEventByID(gomock.Any(), eventID).Return(nil, errors.New("connection refused"))
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/events/"+eventID+"/validate", nil)
+	Get(mock_config.NewMockConfig(ctrl), mockDB, log.NewEntry(log.New())).Validate(responseRecorder, mux.SetURLVars(request, map[string]string{"id": eventID}))
+	assert.Equal(t, http.StatusInternalServerError, responseRecorder.Code)
+
+	mockCfg := mock_config.NewMockConfig(gomock.NewController(t))
+	mockCfg.EXPECT().PublishTokens().Return([]string{"secret"})
+	db := memory.New(log.NewEntry(log.New()))
+	app := Get(mockCfg, db, log.NewEntry(log.New()))
+	invalid := strings.Replace(string(activityJSON), `"name": "Test activity"`, `"nah": "Test activity"`, 1)
+	request = httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(invalid))
+	request.Header.Set("Authorization", "Bearer secret")
+	responseRecorder = httptest.NewRecorder()
+	app.Create(responseRecorder, request)
+	assert.Equal(t, http.StatusBadRequest, responseRecorder.Code)
+	assert.Contains(t, responseRecorder.Body.String(), "event 0: EiffelActivityTriggeredEvent/3.0.0: ")
+	assert.Equal(t, 0, db.Len())
+}
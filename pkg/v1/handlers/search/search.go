@@ -16,12 +16,22 @@
 package search
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/eiffel-community/eiffel-goer/internal/config"
 	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/graph"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
 	"github.com/eiffel-community/eiffel-goer/internal/responses"
 )
 
@@ -38,8 +48,252 @@ func Get(cfg config.Config, db drivers.Database, logger *log.Entry) *Handler {
 	}
 }
 
+type searchResponse struct {
+	UpstreamLinkObjects   []drivers.EiffelEvent `json:"upstreamLinkObjects"`
+	DownstreamLinkObjects []drivers.EiffelEvent `json:"downstreamLinkObjects"`
+}
+
+type treeResponse struct {
+	UpstreamLinkObjects   *treeNode `json:"upstreamLinkObjects"`
+	DownstreamLinkObjects *treeNode `json:"downstreamLinkObjects"`
+}
+
+// treeNode is an event in the tree representation of a search result. LinkType is
+// the type of the link between the event and its parent in the tree.
+type treeNode struct {
+	LinkType string              `json:"linkType,omitempty"`
+	Event    drivers.EiffelEvent `json:"event"`
+	Children []*treeNode         `json:"children"`
+}
+
+// buildTree builds a tree from the events and edges of a search, with the first event
+// as root. The edges are followed from source to target if upstream is true and from
+// target to source otherwise. Each event is added once, under the parent closest to
+// the root, so events that are reachable in several ways are not repeated.
+func buildTree(events []drivers.EiffelEvent, edges []drivers.Edge, upstream bool) *treeNode {
+	if len(events) == 0 {
+		return nil
+	}
+	byID := make(map[string]drivers.EiffelEvent, len(events))
+	for _, event := range events {
+		byID[event.ID()] = event
+	}
+	children := make(map[string][]drivers.Edge)
+	for _, edge := range edges {
+		parent := edge.Target
+		if upstream {
+			parent = edge.Source
+		}
+		children[parent] = append(children[parent], edge)
+	}
+
+	root := &treeNode{Event: events[0], Children: []*treeNode{}}
+	added := map[string]struct{}{events[0].ID(): {}}
+	queue := []*treeNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, edge := range children[node.Event.ID()] {
+			child := edge.Source
+			if upstream {
+				child = edge.Target
+			}
+			if _, ok := added[child]; ok {
+				continue
+			}
+			added[child] = struct{}{}
+			childNode := &treeNode{LinkType: edge.Type, Event: byID[child], Children: []*treeNode{}}
+			node.Children = append(node.Children, childNode)
+			queue = append(queue, childNode)
+		}
+	}
+	return root
+}
+
+// contentTypes are the content types that search results can be rendered as.
+var contentTypes = append([]string{"application/json"}, graph.ContentTypes...)
+
+// negotiate returns the offered content type that is most preferred by an Accept header,
+// or an empty string if none of them is explicitly accepted. Wildcards are ignored since
+// the first offer is the default content type.
+func negotiate(accept string, offers []string) string {
+	best, bestQuality := "", 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if !slices.Contains(offers, mediaType) {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				quality, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = mediaType, quality
+		}
+	}
+	return best
+}
+
+// newSearchRequest creates a search request with default values, overridden by
+// the query parameters of an HTTP request. Query parameters that are not search
+// parameters are conditions that the events found by the search must match.
+func newSearchRequest(r *http.Request) (requests.SearchRequest, error) {
+	request := requests.SearchRequest{
+		Limit:    -1,
+		Levels:   -1,
+		Tree:     false,
+		Shallow:  false,
+		Readable: false,
+	}
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
+	if err := decoder.Decode(&request, r.URL.Query()); err != nil {
+		return request, err
+	}
+	request.DLT = splitLinkTypes(request.DLT)
+	request.ULT = splitLinkTypes(request.ULT)
+
+	conditions, err := requests.BuildConditions(r.URL.RawQuery, requests.SchemaTags(&request))
+	if err != nil {
+		return request, err
+	}
+	request.Conditions = conditions
+	return request, nil
+}
+
+// splitLinkTypes splits comma separated link types, i.e. "dlt=CAUSE,CONTEXT" is the same as
+// "dlt=CAUSE&dlt=CONTEXT".
+func splitLinkTypes(linkTypes []string) []string {
+	if linkTypes == nil {
+		return nil
+	}
+	split := []string{}
+	for _, linkType := range linkTypes {
+		for _, t := range strings.Split(linkType, ",") {
+			if t != "" {
+				split = append(split, t)
+			}
+		}
+	}
+	return split
+}
+
+// readable returns copies of events with readable times.
+func readable(events []drivers.EiffelEvent) []drivers.EiffelEvent {
+	readableEvents := make([]drivers.EiffelEvent, 0, len(events))
+	for _, event := range events {
+		readableEvents = append(readableEvents, event.Readable())
+	}
+	return readableEvents
+}
+
 // UpstreamDownstream handles POST requests against the /search/{id} endpoint.
 // To get upstream/downstream events for an event based on the searchParameters passed.
-func (h *Handler) UpstreamDownstream(w http.ResponseWriter, _ *http.Request) {
-	responses.RespondWithError(w, http.StatusNotImplemented, http.StatusText(http.StatusNotImplemented))
+func (h *Handler) UpstreamDownstream(w http.ResponseWriter, r *http.Request) {
+	request, err := newSearchRequest(r)
+	if err != nil {
+		h.Logger.Error(err)
+		responses.RespondWithError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request.SearchParameters); err != nil && !errors.Is(err, io.EOF) {
+		h.Logger.Error(err)
+		responses.RespondWithError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+	h.search(w, r, request)
+}
+
+// UpstreamDownstreamQuery handles GET requests against the /search/{id} endpoint.
+// To get upstream/downstream events for an event based on the query parameters passed.
+func (h *Handler) UpstreamDownstreamQuery(w http.ResponseWriter, r *http.Request) {
+	request, err := newSearchRequest(r)
+	if err != nil {
+		h.Logger.Error(err)
+		responses.RespondWithError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+	h.search(w, r, request)
+}
+
+// search does an upstream/downstream search and writes the result as a response.
+func (h *Handler) search(w http.ResponseWriter, r *http.Request, request requests.SearchRequest) {
+	if request.DLT == nil && request.ULT == nil {
+		// No link types at all means that all links are followed.
+		request.DLT = []string{requests.LinkTypeAll}
+		request.ULT = []string{requests.LinkTypeAll}
+	}
+	db := h.Database
+	if request.Shallow {
+		db = drivers.Local(db)
+	}
+	vars := mux.Vars(r)
+	result, err := db.UpstreamDownstreamSearch(r.Context(), vars["id"], request)
+	if errors.Is(err, drivers.ErrEventNotFound) {
+		responses.RespondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	} else if err != nil {
+		h.Logger.Error(err)
+		responses.RespondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if request.Readable {
+		result.Upstream = readable(result.Upstream)
+		result.Downstream = readable(result.Downstream)
+	}
+	if contentType := negotiate(r.Header.Get("Accept"), contentTypes); slices.Contains(graph.ContentTypes, contentType) {
+		content, err := graph.FromSearch(result).Render(contentType)
+		if err != nil {
+			h.Logger.Error(err)
+			responses.RespondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+		responses.RespondWithContent(w, http.StatusOK, contentType, content)
+		return
+	}
+	if request.Tree {
+		responses.RespondWithJSON(w, http.StatusOK, treeResponse{
+			UpstreamLinkObjects:   buildTree(result.Upstream, result.UpstreamEdges, true),
+			DownstreamLinkObjects: buildTree(result.Downstream, result.DownstreamEdges, false),
+		})
+		return
+	}
+	responses.RespondWithJSON(w, http.StatusOK, searchResponse{
+		UpstreamLinkObjects:   result.Upstream,
+		DownstreamLinkObjects: result.Downstream,
+	})
+}
+
+// Path handles GET requests against the /search/path endpoint.
+// To get the shortest chain of links between two events.
+func (h *Handler) Path(w http.ResponseWriter, r *http.Request) {
+	request := requests.PathRequest{
+		Levels: -1,
+	}
+	if err := schema.NewDecoder().Decode(&request, r.URL.Query()); err != nil {
+		h.Logger.Error(err)
+		responses.RespondWithError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+	request.LinkTypes = splitLinkTypes(request.LinkTypes)
+	if len(request.LinkTypes) == 0 {
+		request.LinkTypes = []string{requests.LinkTypeAll}
+	}
+
+	path, err := h.Database.ShortestPath(r.Context(), request)
+	if errors.Is(err, drivers.ErrEventNotFound) || errors.Is(err, drivers.ErrPathNotFound) {
+		responses.RespondWithError(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	} else if err != nil {
+		h.Logger.Error(err)
+		responses.RespondWithError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	responses.RespondWithJSON(w, http.StatusOK, path)
 }
@@ -0,0 +1,422 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+	"github.com/eiffel-community/eiffel-goer/test/mock_config"
+	"github.com/eiffel-community/eiffel-goer/test/mock_drivers"
+)
+
+const eventID = "e04cf9d3-4d57-471e-bd65-f8fc20d21d84"
+
+var activityJSON = []byte(`
+{
+    "data": {
+        "name": "Test activity"
+    },
+    "links": [],
+    "meta": {
+        "id": "e04cf9d3-4d57-471e-bd65-f8fc20d21d84",
+        "time": 1629449650361,
+        "type": "EiffelActivityTriggeredEvent",
+        "version": "3.0.0"
+    }
+}
+`)
+
+// Test that the search/{id} endpoint parses search parameters and responds as expected.
+func TestUpstreamDownstream(t *testing.T) {
+	eventMap := make(drivers.EiffelEvent)
+	require.NoError(t, json.Unmarshal(activityJSON, &eventMap))
+	result := drivers.SearchResult{
+		Upstream:   []drivers.EiffelEvent{eventMap},
+		Downstream: []drivers.EiffelEvent{eventMap},
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		body       io.Reader
+		statusCode int
+		expected   *requests.SearchRequest
+		mockError  error
+	}{
+		{
+			name:       "NoBody",
+			url:        "/search/" + eventID,
+			statusCode: http.StatusOK,
+			expected: &requests.SearchRequest{
+				Limit: -1, Levels: -1,
+				SearchParameters: requests.SearchParameters{DLT: []string{"ALL"}, ULT: []string{"ALL"}},
+			},
+		},
+		{
+			name:       "LinkTypesLimitAndLevels",
+			url:        "/search/" + eventID + "?limit=10&levels=2",
+			body:       strings.NewReader(`{"dlt": ["CAUSE", "CONTEXT"], "ult": []}`),
+			statusCode: http.StatusOK,
+			expected: &requests.SearchRequest{
+				Limit: 10, Levels: 2,
+				SearchParameters: requests.SearchParameters{DLT: []string{"CAUSE", "CONTEXT"}, ULT: []string{}},
+			},
+		},
+		{name: "BadBody", url: "/search/" + eventID, body: strings.NewReader(`{"nah": []}`), statusCode: http.StatusBadRequest},
+		{name: "BadQuery", url: "/search/" + eventID + "?levels=many", statusCode: http.StatusBadRequest},
+		{
+			name:       "NotFound",
+			url:        "/search/" + eventID,
+			statusCode: http.StatusNotFound,
+			expected: &requests.SearchRequest{
+				Limit: -1, Levels: -1,
+				SearchParameters: requests.SearchParameters{DLT: []string{"ALL"}, ULT: []string{"ALL"}},
+			},
+			mockError: drivers.ErrEventNotFound,
+		},
+		{
+			name:       "DatabaseError",
+			url:        "/search/" + eventID,
+			statusCode: http.StatusInternalServerError,
+			expected: &requests.SearchRequest{
+				Limit: -1, Levels: -1,
+				SearchParameters: requests.SearchParameters{DLT: []string{"ALL"}, ULT: []string{"ALL"}},
+			},
+			mockError: errors.New("database error"),
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockCfg := mock_config.NewMockConfig(ctrl)
+			mockDB := mock_drivers.NewMockDatabase(ctrl)
+			if testCase.expected != nil {
+				mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), eventID, *testCase.expected).Return(result, testCase.mockError)
+			}
+			app := Get(mockCfg, mockDB, log.NewEntry(log.New()))
+			handler := mux.NewRouter()
+			handler.HandleFunc("/search/{id}", app.UpstreamDownstream)
+
+			responseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodPost, testCase.url, testCase.body))
+
+			assert.Equal(t, testCase.statusCode, responseRecorder.Code)
+			if responseRecorder.Code == http.StatusOK {
+				assert.JSONEq(t,
+					`{"upstreamLinkObjects": [`+string(activityJSON)+`], "downstreamLinkObjects": [`+string(activityJSON)+`]}`,
+					responseRecorder.Body.String(),
+				)
+			}
+		})
+	}
+}
+
+// event creates a minimal event with an ID and links of the form "TYPE:target".
+func event(t *testing.T, id string, links ...string) drivers.EiffelEvent {
+	t.Helper()
+	eventLinks := []interface{}{}
+	for _, link := range links {
+		linkType, target, ok := strings.Cut(link, ":")
+		require.True(t, ok)
+		eventLinks = append(eventLinks, map[string]interface{}{"type": linkType, "target": target})
+	}
+	return drivers.EiffelEvent{"meta": map[string]interface{}{"id": id}, "links": eventLinks}
+}
+
+// Test that the tree parameter makes the search/{id} endpoint respond with trees.
+func TestUpstreamDownstreamTree(t *testing.T) {
+	a := event(t, eventID, "CAUSE:b", "CONTEXT:c")
+	b := event(t, "b", "CONTEXT:c")
+	c := event(t, "c")
+	d := event(t, "d", "CAUSE:"+eventID)
+	e := event(t, "e", "FLOW_CONTEXT:d")
+	upstream := []drivers.EiffelEvent{a, b, c}
+	downstream := []drivers.EiffelEvent{a, d, e}
+	result := drivers.SearchResult{
+		Upstream:        upstream,
+		UpstreamEdges:   drivers.EdgesBetween(upstream, []string{"ALL"}),
+		Downstream:      downstream,
+		DownstreamEdges: drivers.EdgesBetween(downstream, []string{"ALL"}),
+	}
+
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), eventID, gomock.Any()).Return(result, nil)
+	app := Get(mock_config.NewMockConfig(ctrl), mockDB, log.NewEntry(log.New()))
+	handler := mux.NewRouter()
+	handler.HandleFunc("/search/{id}", app.UpstreamDownstream)
+
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodPost, "/search/"+eventID+"?tree=true", nil))
+
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.JSONEq(t, `{
+		"upstreamLinkObjects": {
+			"event": {"meta": {"id": "`+eventID+`"}, "links": [{"type": "CAUSE", "target": "b"}, {"type": "CONTEXT", "target": "c"}]},
+			"children": [
+				{"linkType": "CAUSE", "event": {"meta": {"id": "b"}, "links": [{"type": "CONTEXT", "target": "c"}]}, "children": []},
+				{"linkType": "CONTEXT", "event": {"meta": {"id": "c"}, "links": []}, "children": []}
+			]
+		},
+		"downstreamLinkObjects": {
+			"event": {"meta": {"id": "`+eventID+`"}, "links": [{"type": "CAUSE", "target": "b"}, {"type": "CONTEXT", "target": "c"}]},
+			"children": [
+				{"linkType": "CAUSE", "event": {"meta": {"id": "d"}, "links": [{"type": "CAUSE", "target": "`+eventID+`"}]}, "children": [
+					{"linkType": "FLOW_CONTEXT", "event": {"meta": {"id": "e"}, "links": [{"type": "FLOW_CONTEXT", "target": "d"}]}, "children": []}
+				]}
+			]
+		}
+	}`, responseRecorder.Body.String())
+}
+
+// Test that the readable parameter makes the search/{id} endpoint respond with readable times.
+func TestUpstreamDownstreamReadable(t *testing.T) {
+	a := event(t, eventID, "CAUSE:b")
+	a["meta"].(map[string]interface{})["time"] = int64(1629449650361)
+	b := event(t, "b")
+	b["meta"].(map[string]interface{})["time"] = int64(0)
+	result := drivers.SearchResult{
+		Upstream:      []drivers.EiffelEvent{a, b},
+		UpstreamEdges: drivers.EdgesBetween([]drivers.EiffelEvent{a, b}, []string{"ALL"}),
+	}
+
+	ctrl := gomock.NewController(t)
+	mockDB := mock_drivers.NewMockDatabase(ctrl)
+	mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), eventID, gomock.Any()).Return(result, nil)
+	app := Get(mock_config.NewMockConfig(ctrl), mockDB, log.NewEntry(log.New()))
+	handler := mux.NewRouter()
+	handler.HandleFunc("/search/{id}", app.UpstreamDownstreamQuery)
+
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/search/"+eventID+"?readable=true", nil))
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.JSONEq(t, `{
+		"upstreamLinkObjects": [
+			{"meta": {"id": "`+eventID+`", "time": "2021-08-20T08:54:10.361Z"}, "links": [{"type": "CAUSE", "target": "b"}]},
+			{"meta": {"id": "b", "time": "1970-01-01T00:00:00.000Z"}, "links": []}
+		],
+		"downstreamLinkObjects": []
+	}`, responseRecorder.Body.String())
+
+	// Graphs have readable times too.
+	mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), eventID, gomock.Any()).Return(result, nil)
+	request := httptest.NewRequest(http.MethodGet, "/search/"+eventID+"?readable=true", nil)
+	request.Header.Set("Accept", "text/vnd.graphviz")
+	responseRecorder = httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, request)
+	assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.Contains(t, responseRecorder.Body.String(), `time="2021-08-20T08:54:10.361Z"`)
+}
+
+// Test that the GET variant of the search/{id} endpoint parses query parameters.
+func TestUpstreamDownstreamQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		expected   *requests.SearchRequest
+	}{
+		{
+			name:       "NoParameters",
+			query:      "",
+			statusCode: http.StatusOK,
+			expected: &requests.SearchRequest{
+				Limit: -1, Levels: -1,
+				SearchParameters: requests.SearchParameters{DLT: []string{"ALL"}, ULT: []string{"ALL"}},
+			},
+		},
+		{
+			name:       "RepeatedLinkTypes",
+			query:      "?dlt=CAUSE&dlt=CONTEXT&limit=5",
+			statusCode: http.StatusOK,
+			expected: &requests.SearchRequest{
+				Limit: 5, Levels: -1,
+				SearchParameters: requests.SearchParameters{DLT: []string{"CAUSE", "CONTEXT"}},
+			},
+		},
+		{
+			name:       "CommaSeparatedLinkTypes",
+			query:      "?ult=CAUSE,FLOW_CONTEXT&dlt=ALL&levels=3&tree=true",
+			statusCode: http.StatusOK,
+			expected: &requests.SearchRequest{
+				Limit: -1, Levels: 3, Tree: true,
+				SearchParameters: requests.SearchParameters{DLT: []string{"ALL"}, ULT: []string{"CAUSE", "FLOW_CONTEXT"}},
+			},
+		},
+		{
+			name:       "Conditions",
+			query:      "?meta.type=EiffelConfidenceLevelModifiedEvent&dlt=ALL&data.value=SUCCESS",
+			statusCode: http.StatusOK,
+			expected: &requests.SearchRequest{
+				Limit: -1, Levels: -1,
+				SearchParameters: requests.SearchParameters{DLT: []string{"ALL"}},
+				Conditions: []query.Condition{
+					{Field: "meta.type", Op: "=", Value: "EiffelConfidenceLevelModifiedEvent"},
+					{Field: "data.value", Op: "=", Value: "SUCCESS"},
+				},
+			},
+		},
+		{name: "BadCondition", query: "?dlt=ALL&(nah", statusCode: http.StatusBadRequest},
+		{name: "BadLimit", query: "?limit=all", statusCode: http.StatusBadRequest},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDB := mock_drivers.NewMockDatabase(ctrl)
+			if testCase.expected != nil {
+				mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), eventID, *testCase.expected).Return(drivers.SearchResult{}, nil)
+			}
+			app := Get(mock_config.NewMockConfig(ctrl), mockDB, log.NewEntry(log.New()))
+			handler := mux.NewRouter()
+			handler.HandleFunc("/search/{id}", app.UpstreamDownstreamQuery)
+
+			responseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, "/search/"+eventID+testCase.query, nil))
+
+			assert.Equal(t, testCase.statusCode, responseRecorder.Code)
+		})
+	}
+}
+
+// Test that the Accept header selects the format of the search result.
+func TestUpstreamDownstreamGraph(t *testing.T) {
+	a := event(t, eventID, "CAUSE:b")
+	b := event(t, "b")
+	result := drivers.SearchResult{
+		Upstream:      []drivers.EiffelEvent{a, b},
+		UpstreamEdges: drivers.EdgesBetween([]drivers.EiffelEvent{a, b}, []string{"ALL"}),
+	}
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{name: "Default", accept: "", contentType: "application/json"},
+		{name: "Wildcard", accept: "*/*", contentType: "application/json"},
+		{name: "DOT", accept: "text/vnd.graphviz", contentType: "text/vnd.graphviz"},
+		{name: "GraphML", accept: "application/xml;q=0.9, application/graphml+xml", contentType: "application/graphml+xml"},
+		{name: "Mermaid", accept: "text/vnd.graphviz;q=0.5, text/vnd.mermaid;q=0.8", contentType: "text/vnd.mermaid"},
+		{name: "PreferJSON", accept: "application/json, text/vnd.graphviz;q=0.5", contentType: "application/json"},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDB := mock_drivers.NewMockDatabase(ctrl)
+			mockDB.EXPECT().UpstreamDownstreamSearch(gomock.Any(), eventID, gomock.Any()).Return(result, nil)
+			app := Get(mock_config.NewMockConfig(ctrl), mockDB, log.NewEntry(log.New()))
+			handler := mux.NewRouter()
+			handler.HandleFunc("/search/{id}", app.UpstreamDownstreamQuery)
+
+			request := httptest.NewRequest(http.MethodGet, "/search/"+eventID, nil)
+			request.Header.Set("Accept", testCase.accept)
+			responseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, http.StatusOK, responseRecorder.Code)
+			assert.Equal(t, testCase.contentType, responseRecorder.Header().Get("Content-Type"))
+		})
+	}
+}
+
+// Test that the search/path endpoint parses parameters and responds as expected.
+func TestPath(t *testing.T) {
+	a := event(t, eventID, "CAUSE:b")
+	b := event(t, "b")
+	path := drivers.Path{
+		Events: []drivers.EiffelEvent{a, b},
+		Edges:  []drivers.Edge{{Source: eventID, Link: drivers.Link{Type: "CAUSE", Target: "b"}}},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		expected   *requests.PathRequest
+		mockError  error
+	}{
+		{
+			name:       "AllLinkTypes",
+			query:      "?from=" + eventID + "&to=b",
+			statusCode: http.StatusOK,
+			expected:   &requests.PathRequest{From: eventID, To: "b", LinkTypes: []string{"ALL"}, Levels: -1},
+		},
+		{
+			name:       "LinkTypesAndLevels",
+			query:      "?from=" + eventID + "&to=b&linkTypes=CAUSE,IUT&levels=4",
+			statusCode: http.StatusOK,
+			expected:   &requests.PathRequest{From: eventID, To: "b", LinkTypes: []string{"CAUSE", "IUT"}, Levels: 4},
+		},
+		{name: "MissingTo", query: "?from=" + eventID, statusCode: http.StatusBadRequest},
+		{
+			name:       "NotLinked",
+			query:      "?from=" + eventID + "&to=b",
+			statusCode: http.StatusNotFound,
+			expected:   &requests.PathRequest{From: eventID, To: "b", LinkTypes: []string{"ALL"}, Levels: -1},
+			mockError:  drivers.ErrPathNotFound,
+		},
+		{
+			name:       "NotFound",
+			query:      "?from=" + eventID + "&to=b",
+			statusCode: http.StatusNotFound,
+			expected:   &requests.PathRequest{From: eventID, To: "b", LinkTypes: []string{"ALL"}, Levels: -1},
+			mockError:  drivers.ErrEventNotFound,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockDB := mock_drivers.NewMockDatabase(ctrl)
+			if testCase.expected != nil {
+				mockDB.EXPECT().ShortestPath(gomock.Any(), *testCase.expected).Return(path, testCase.mockError)
+			}
+			app := Get(mock_config.NewMockConfig(ctrl), mockDB, log.NewEntry(log.New()))
+
+			responseRecorder := httptest.NewRecorder()
+			app.Path(responseRecorder, httptest.NewRequest(http.MethodGet, "/search/path"+testCase.query, nil))
+
+			assert.Equal(t, testCase.statusCode, responseRecorder.Code)
+			if responseRecorder.Code == http.StatusOK {
+				assert.JSONEq(t, `{
+					"events": [
+						{"meta": {"id": "`+eventID+`"}, "links": [{"type": "CAUSE", "target": "b"}]},
+						{"meta": {"id": "b"}, "links": []}
+					],
+					"links": [{"source": "`+eventID+`", "type": "CAUSE", "target": "b"}]
+				}`, responseRecorder.Body.String())
+			}
+		})
+	}
+}
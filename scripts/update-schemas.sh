@@ -0,0 +1,25 @@
+#!/bin/bash
+
+# Copy the Eiffel event schemas of an edition of the Eiffel protocol into
+# internal/validation/schemas, where they are embedded in Goer, e.g.
+#
+#     scripts/update-schemas.sh edition-lyon
+#
+# The schemas are in schemas/<meta.type>/<meta.version>.json in the protocol
+# repository, which is the layout that Goer looks them up in.
+
+set -e
+
+REF=${1:?usage: $0 <edition tag, branch or commit of the Eiffel protocol>}
+REPOSITORY=${EIFFEL_REPOSITORY:-https://github.com/eiffel-community/eiffel.git}
+DESTINATION=$(cd "$(dirname "$0")/../internal/validation/schemas" && pwd)
+
+CHECKOUT=$(mktemp -d)
+trap 'rm -rf "$CHECKOUT"' EXIT
+
+git clone --quiet "$REPOSITORY" "$CHECKOUT"
+git -C "$CHECKOUT" checkout --quiet "$REF"
+
+find "$DESTINATION" -mindepth 1 -maxdepth 1 -type d -exec rm -r {} +
+(cd "$CHECKOUT/schemas" && find . -name '*.json' -print0 | xargs -0 -I{} cp --parents {} "$DESTINATION")
+echo "Copied $(find "$DESTINATION" -name '*.json' | wc -l) schemas from $REPOSITORY at $REF"
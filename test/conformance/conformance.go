@@ -0,0 +1,334 @@
+// Copyright 2021 Axis Communications AB.
+//
+// For a full list of individual contributors, please see the commit history.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This package is a conformance test suite for database drivers. Every driver
+// shall pass it, so that the API behaves the same whichever database is used:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(t *testing.T, events []drivers.EiffelEvent) drivers.Database {
+//			// Return a database that has the events, and nothing else.
+//		})
+//	}
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eiffel-community/eiffel-goer/internal/database/drivers"
+	"github.com/eiffel-community/eiffel-goer/internal/query"
+	"github.com/eiffel-community/eiffel-goer/internal/requests"
+)
+
+// Open returns a database that has the events, and nothing else. It fails the test,
+// or skips it, if there is no such database.
+type Open func(t *testing.T, events []drivers.EiffelEvent) drivers.Database
+
+// fixture is an activity that was triggered by an artifact, produced another artifact
+// and was followed by a confidence level:
+//
+//	e1 <-CAUSE- e2 <-ACTIVITY_EXECUTION- e3, e4
+//	            e2 <-CONTEXT- e5 <-SUBJECT- e6 -CAUSE-> e4
+var fixture = []byte(`
+{"meta": {"id": "e1", "type": "EiffelArtifactCreatedEvent", "version": "3.0.0", "time": 1000}, "data": {"identity": "pkg:maven/com.example/app@1.0.0", "published": true}, "links": []}
+{"meta": {"id": "e2", "type": "EiffelActivityTriggeredEvent", "version": "4.0.0", "time": 2000}, "data": {"name": "Build", "triggers": [{"type": "MANUAL"}]}, "links": [{"type": "CAUSE", "target": "e1"}]}
+{"meta": {"id": "e3", "type": "EiffelActivityStartedEvent", "version": "4.0.0", "time": 3000}, "data": {}, "links": [{"type": "ACTIVITY_EXECUTION", "target": "e2"}]}
+{"meta": {"id": "e4", "type": "EiffelActivityFinishedEvent", "version": "3.0.0", "time": 4000}, "data": {"outcome": {"conclusion": "SUCCESSFUL"}}, "links": [{"type": "ACTIVITY_EXECUTION", "target": "e2"}]}
+{"meta": {"id": "e5", "type": "EiffelArtifactCreatedEvent", "version": "3.0.0", "time": 5000}, "data": {"identity": "pkg:maven/com.example/lib@2.1.0", "published": false}, "links": [{"type": "CONTEXT", "target": "e2"}]}
+{"meta": {"id": "e6", "type": "EiffelConfidenceLevelModifiedEvent", "version": "3.0.0", "time": 6000}, "data": {"name": "stable (main|1.x)", "value": "SUCCESS"}, "links": [{"type": "SUBJECT", "target": "e5"}, {"type": "CAUSE", "target": "e4"}]}
+`)
+
+// Events returns the events of the fixture, decoded in the same way as drivers decode
+// events. A new copy is returned for every call.
+func Events() []drivers.EiffelEvent {
+	var events []drivers.EiffelEvent
+	for _, line := range bytes.Split(bytes.TrimSpace(fixture), []byte("\n")) {
+		event, err := drivers.DecodeEvent(line)
+		if err != nil {
+			panic(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// Run runs the conformance test suite against the databases returned by open.
+func Run(t *testing.T, open Open) {
+	db := open(t, Events())
+	t.Cleanup(func() {
+		assert.NoError(t, db.Close(context.Background()))
+	})
+	t.Run("GetEventByID", func(t *testing.T) { testGetEventByID(t, db) })
+	t.Run("Conditions", func(t *testing.T) { testConditions(t, db) })
+	t.Run("Paging", func(t *testing.T) { testPaging(t, db) })
+	t.Run("UpstreamDownstreamSearch", func(t *testing.T) { testUpstreamDownstreamSearch(t, db) })
+	t.Run("ShortestPath", func(t *testing.T) { testShortestPath(t, db) })
+}
+
+// ids returns the IDs of events.
+func ids(events []drivers.EiffelEvent) []string {
+	result := []string{}
+	for _, event := range events {
+		result = append(result, event.ID())
+	}
+	return result
+}
+
+// parse parses a query string.
+func parse(t *testing.T, rawQuery string) []query.Condition {
+	t.Helper()
+	conditions, err := query.Parse("nofile", []byte(rawQuery))
+	require.NoError(t, err, rawQuery)
+	return conditions.([]query.Condition)
+}
+
+// testGetEventByID tests that whole events are found by ID.
+func testGetEventByID(t *testing.T, db drivers.Database) {
+	ctx := context.Background()
+	event, err := db.GetEventByID(ctx, "e4")
+	require.NoError(t, err)
+	assert.Equal(t, "EiffelActivityFinishedEvent", event.Type())
+	conclusion, _ := event.Get("data.outcome.conclusion")
+	assert.Equal(t, "SUCCESSFUL", conclusion)
+	time, _ := event.Get("meta.time")
+	assert.EqualValues(t, 4000, time)
+	assert.Equal(t, []drivers.Link{{Type: "ACTIVITY_EXECUTION", Target: "e2"}}, event.Links())
+
+	_, err = db.GetEventByID(ctx, "nah")
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+}
+
+// testConditions tests every operator and type cast, in the same way as MongoDB
+// handles them.
+func testConditions(t *testing.T, db drivers.Database) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"meta.type=EiffelArtifactCreatedEvent", []string{"e1", "e5"}},
+		{"meta.type!=EiffelArtifactCreatedEvent", []string{"e2", "e3", "e4", "e6"}},
+		{"int(meta.time)%3E4000", []string{"e5", "e6"}},
+		{"int(meta.time)%3C2000", []string{"e1"}},
+		{"int(meta.time)%3E=4000", []string{"e4", "e5", "e6"}},
+		{"int(meta.time)%3C=2000", []string{"e1", "e2"}},
+		{"meta.type=in(EiffelActivityStartedEvent,EiffelActivityFinishedEvent)", []string{"e3", "e4"}},
+		{"meta.type!=in(EiffelActivityStartedEvent,EiffelActivityFinishedEvent)", []string{"e1", "e2", "e5", "e6"}},
+		{"int(meta.time)=in(1000,6000)", []string{"e1", "e6"}},
+		{"data.identity~=lib@[0-9.]%2B$", []string{"e5"}},
+		{"data.identity~*=APP@", []string{"e1"}},
+		{"data.identity^=pkg:maven/com.example/app", []string{"e1"}},
+		{"data.name^*=BUI", []string{"e2"}},
+		{"data.identity*=lib", []string{"e5"}},
+		{"data.name**=TAB", []string{"e6"}},
+		{"data.outcome", []string{"e4"}},
+		{"!data.outcome", []string{"e1", "e2", "e3", "e5", "e6"}},
+		{"links.type=CONTEXT", []string{"e5"}},
+		{"links.target=e2", []string{"e3", "e4", "e5"}},
+		{"links.type!=CAUSE", []string{"e1", "e3", "e4", "e5"}},
+		{"data.triggers.type=MANUAL", []string{"e2"}},
+		{"meta.time=1000", []string{}},
+		{"double(meta.time)=1000", []string{"e1"}},
+		{"time(meta.time)%3E1970-01-01T00:00:03Z", []string{"e4", "e5", "e6"}},
+		{"bool(data.published)=true", []string{"e1"}},
+		{"bool(data.published)=false", []string{"e5"}},
+		{"data.published=true", []string{}},
+		{"data.name!=Build", []string{"e1", "e3", "e4", "e5", "e6"}},
+		{"meta.version=3.0.0&meta.type=EiffelArtifactCreatedEvent", []string{"e1", "e5"}},
+		{"meta.id=e1|meta.id=e6", []string{"e1", "e6"}},
+		{"(meta.id=e1|meta.id=e6)&meta.type=EiffelArtifactCreatedEvent", []string{"e1"}},
+		{`data.name="stable (main|1.x)"|data.name=Build`, []string{"e2", "e6"}},
+		{"data.name=stable+%28main%7C1.x%29", []string{"e6"}},
+		{`data.name=in("stable (main|1.x)",Build)`, []string{"e2", "e6"}},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.query, func(t *testing.T) {
+			events, total, err := db.GetEvents(context.Background(), requests.MultipleEventsRequest{
+				PageNo:     1,
+				PageSize:   10,
+				Conditions: parse(t, testCase.query),
+			})
+			require.NoError(t, err)
+			assert.Equal(t, testCase.want, ids(events))
+			assert.Equal(t, int64(len(testCase.want)), total)
+		})
+	}
+
+	_, _, err := db.GetEvents(context.Background(), requests.MultipleEventsRequest{
+		PageNo:     1,
+		PageSize:   10,
+		Conditions: []query.Condition{{Field: "meta.time", Op: "=", Value: "nah", TypeConv: "int"}},
+	})
+	assert.Error(t, err)
+}
+
+// testPaging tests that events are sorted, paged and continued after a cursor, and
+// that the total is the number of matching events.
+func testPaging(t *testing.T, db drivers.Database) {
+	ctx := context.Background()
+	events, total, err := db.GetEvents(ctx, requests.MultipleEventsRequest{PageNo: 1, PageSize: 4})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e1", "e2", "e3", "e4"}, ids(events))
+	assert.Equal(t, int64(6), total)
+
+	sort := requests.Sort{{Field: "meta.time", Descending: true}}
+	events, total, err = db.GetEvents(ctx, requests.MultipleEventsRequest{PageNo: 2, PageSize: 2, Sort: sort})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e4", "e3"}, ids(events))
+	assert.Equal(t, int64(6), total)
+
+	events, _, err = db.GetEvents(ctx, requests.MultipleEventsRequest{PageNo: 4, PageSize: 2, Sort: sort})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	// Missing values come first in ascending order.
+	events, _, err = db.GetEvents(ctx, requests.MultipleEventsRequest{PageNo: 1, PageSize: 6, Sort: requests.Sort{{Field: "data.name"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e1", "e3", "e4", "e5", "e2", "e6"}, ids(events))
+
+	sort = requests.Sort{{Field: "meta.type"}, {Field: "meta.time", Descending: true}}
+	request := requests.MultipleEventsRequest{PageNo: 1, PageSize: 2, Sort: sort, Conditions: parse(t, "meta.id!=e3")}
+	var pages [][]string
+	for {
+		events, total, err := db.GetEvents(ctx, request)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), total)
+		if len(events) == 0 {
+			break
+		}
+		pages = append(pages, ids(events))
+		cursor, ok := drivers.CursorAfter(events[len(events)-1], sort)
+		require.True(t, ok)
+		request.Cursor = cursor
+	}
+	assert.Equal(t, [][]string{{"e4", "e2"}, {"e5", "e1"}, {"e6"}}, pages)
+}
+
+// testUpstreamDownstreamSearch tests that links are followed upstream and downstream,
+// within the levels and limit, and that conditions filter the events that are found.
+func testUpstreamDownstreamSearch(t *testing.T, db drivers.Database) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		id         string
+		request    requests.SearchRequest
+		upstream   []string
+		downstream []string
+	}{
+		{
+			name:     "upstream",
+			id:       "e4",
+			request:  requests.SearchRequest{Limit: -1, Levels: -1, SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}}},
+			upstream: []string{"e4", "e2", "e1"},
+		},
+		{
+			name:       "downstream",
+			id:         "e2",
+			request:    requests.SearchRequest{Limit: -1, Levels: -1, SearchParameters: requests.SearchParameters{DLT: []string{"ALL"}}},
+			downstream: []string{"e2", "e3", "e4", "e5", "e6"},
+		},
+		{
+			name:       "link types",
+			id:         "e1",
+			request:    requests.SearchRequest{Limit: -1, Levels: -1, SearchParameters: requests.SearchParameters{DLT: []string{"CAUSE"}}},
+			downstream: []string{"e1", "e2"},
+		},
+		{
+			name:       "both",
+			id:         "e5",
+			request:    requests.SearchRequest{Limit: -1, Levels: -1, SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}, DLT: []string{"ALL"}}},
+			upstream:   []string{"e5", "e2", "e1"},
+			downstream: []string{"e5", "e6"},
+		},
+		{
+			name:     "levels",
+			id:       "e6",
+			request:  requests.SearchRequest{Limit: -1, Levels: 1, SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}}},
+			upstream: []string{"e6", "e4", "e5"},
+		},
+		{
+			name:     "limit",
+			id:       "e4",
+			request:  requests.SearchRequest{Limit: 1, Levels: -1, SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}}},
+			upstream: []string{"e4", "e2"},
+		},
+		{
+			name: "conditions",
+			id:   "e6",
+			request: requests.SearchRequest{
+				Limit:            -1,
+				Levels:           -1,
+				SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}},
+				Conditions:       parse(t, "meta.type!=EiffelActivityTriggeredEvent"),
+			},
+			upstream: []string{"e6", "e4", "e5", "e1"},
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := db.UpstreamDownstreamSearch(ctx, testCase.id, testCase.request)
+			require.NoError(t, err)
+			for _, found := range [][]drivers.EiffelEvent{result.Upstream, result.Downstream} {
+				if len(found) > 0 {
+					assert.Equal(t, testCase.id, found[0].ID(), "the search starts with the event itself")
+				}
+			}
+			if testCase.upstream != nil {
+				assert.ElementsMatch(t, testCase.upstream, ids(result.Upstream))
+			}
+			if testCase.downstream != nil {
+				assert.ElementsMatch(t, testCase.downstream, ids(result.Downstream))
+			}
+		})
+	}
+
+	result, err := db.UpstreamDownstreamSearch(ctx, "e5", requests.SearchRequest{
+		Limit: -1, Levels: -1, SearchParameters: requests.SearchParameters{ULT: []string{"ALL"}},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []drivers.Edge{
+		{Source: "e5", Link: drivers.Link{Type: "CONTEXT", Target: "e2"}},
+		{Source: "e2", Link: drivers.Link{Type: "CAUSE", Target: "e1"}},
+	}, result.UpstreamEdges)
+
+	_, err = db.UpstreamDownstreamSearch(ctx, "nah", requests.SearchRequest{Limit: -1, Levels: -1})
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+}
+
+// testShortestPath tests that the shortest chain of links is found in either direction.
+func testShortestPath(t *testing.T, db drivers.Database) {
+	ctx := context.Background()
+	path, err := db.ShortestPath(ctx, requests.PathRequest{From: "e1", To: "e3", LinkTypes: []string{"ALL"}, Levels: -1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e1", "e2", "e3"}, ids(path.Events))
+	assert.Len(t, path.Edges, 2)
+
+	path, err = db.ShortestPath(ctx, requests.PathRequest{From: "e6", To: "e1", LinkTypes: []string{"ALL"}, Levels: -1})
+	require.NoError(t, err)
+	require.Len(t, path.Events, 4)
+	assert.Equal(t, "e6", path.Events[0].ID())
+	assert.Equal(t, []string{"e2", "e1"}, ids(path.Events[2:]))
+
+	_, err = db.ShortestPath(ctx, requests.PathRequest{From: "e6", To: "e1", LinkTypes: []string{"ALL"}, Levels: 2})
+	assert.ErrorIs(t, err, drivers.ErrPathNotFound)
+	_, err = db.ShortestPath(ctx, requests.PathRequest{From: "e3", To: "e5", LinkTypes: []string{"CAUSE"}, Levels: -1})
+	assert.ErrorIs(t, err, drivers.ErrPathNotFound)
+	_, err = db.ShortestPath(ctx, requests.PathRequest{From: "e1", To: "nah", LinkTypes: []string{"ALL"}, Levels: -1})
+	assert.ErrorIs(t, err, drivers.ErrEventNotFound)
+}